@@ -0,0 +1,163 @@
+package main
+
+import (
+	"backend/service"
+	"backend/viewmodel"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// apiPrefix is the root of the JSON API. Entities are encoded as GeneralEntity,
+// an object of OutputProperty keyed by property name.
+const apiPrefix = "/api/v1"
+
+const (
+	apiDefaultLimit = 50
+	apiMaxLimit     = 1000
+)
+
+type NamespacesResponse struct {
+	Namespaces []string `json:"namespaces"`
+}
+
+type KindsResponse struct {
+	Namespace string   `json:"namespace"`
+	Kinds     []string `json:"kinds"`
+}
+
+type EntitiesResponse struct {
+	Entities []service.GeneralEntity `json:"entities"`
+	Cursor   string                  `json:"cursor"` // empty on the last page
+}
+
+type DeleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// ServeAPINamespaces lists the namespaces, the default namespace is ""
+func (as *APIServer) ServeAPINamespaces(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return methodNotAllowed(w, r, http.MethodGet)
+	}
+	namespaces, err := service.GetAllNamespaces(r.Context(), as.client)
+	if err != nil {
+		return err
+	}
+	WriteJSON(w, http.StatusOK, NamespacesResponse{Namespaces: nonNil(namespaces)})
+	return nil
+}
+
+// ServeAPIKinds lists the kinds of the namespace in ?ns=
+func (as *APIServer) ServeAPIKinds(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return methodNotAllowed(w, r, http.MethodGet)
+	}
+	namespace := r.URL.Query().Get(viewmodel.ParamNamespace)
+	kinds, err := service.GetAllKinds(r.Context(), as.client, namespace)
+	if err != nil {
+		return err
+	}
+	WriteJSON(w, http.StatusOK, KindsResponse{Namespace: namespace, Kinds: nonNil(kinds)})
+	return nil
+}
+
+// ServeAPIEntities queries a page of entities. It takes the query string of the
+// table view (ns, kind, sort, dir, fp/fo/fv/ft, cursor) plus a limit.
+// Filters without a type compare as strings.
+func (as *APIServer) ServeAPIEntities(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return methodNotAllowed(w, r, http.MethodGet)
+	}
+	state := viewmodel.ParseTableState(r.URL.Query())
+	if state.Kind == "" {
+		return fmt.Errorf("kind is required")
+	}
+
+	limit := apiDefaultLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 || limit > apiMaxLimit {
+			return fmt.Errorf("limit must be between 1 and %d", apiMaxLimit)
+		}
+	}
+
+	entities, cursor, err := service.GetAllEntities(r.Context(), as.client, state.Query(limit))
+	if err != nil {
+		return err
+	}
+	WriteJSON(w, http.StatusOK, EntitiesResponse{Entities: nonNil(entities), Cursor: cursor})
+	return nil
+}
+
+// ServeAPIEntity gets, puts or deletes the entity at /entities/<encoded key>.
+// A put replaces every property with the GeneralEntity in the body and returns
+// the stored entity. Getting or deleting a key without entity answers 404.
+func (as *APIServer) ServeAPIEntity(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		return methodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+	encoded := strings.TrimPrefix(r.URL.Path, apiPrefix+"/entities/")
+	key, err := datastore.DecodeKey(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid key %q", encoded)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var entity service.GeneralEntity
+		if err := json.NewDecoder(r.Body).Decode(&entity); err != nil {
+			return fmt.Errorf("invalid entity: %s", err)
+		}
+		// The key column is synthetic, the key comes from the path
+		delete(entity, "key")
+		if key, err = service.PutEntity(r.Context(), as.client, key, entity); err != nil {
+			return err
+		}
+		as.stats.Forget(key.Namespace, key.Kind)
+	case http.MethodDelete:
+		deleted, err := service.DeleteEntities(r.Context(), as.client, []*datastore.Key{key})
+		as.stats.Forget(key.Namespace, key.Kind)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			WriteJSON(w, http.StatusNotFound, HttpError{Message: fmt.Sprintf("no entity %s", key)})
+			return nil
+		}
+		WriteJSON(w, http.StatusOK, DeleteResponse{Deleted: deleted})
+		return nil
+	}
+
+	entity, err := service.GetEntity(r.Context(), as.client, key)
+	if err == datastore.ErrNoSuchEntity {
+		WriteJSON(w, http.StatusNotFound, HttpError{Message: fmt.Sprintf("no entity %s", key)})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entity["key"] = service.OutputProperty{Name: "key", Value: key, TypeOf: service.TypeKey, Indexed: true}
+	WriteJSON(w, http.StatusOK, entity)
+	return nil
+}
+
+// methodNotAllowed answers 405 with the methods the endpoint serves in Allow
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) error {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	WriteJSON(w, http.StatusMethodNotAllowed, HttpError{Message: fmt.Sprintf("method %s not allowed", r.Method)})
+	return nil
+}
+
+// nonNil makes empty lists encode as [] instead of null
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
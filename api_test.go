@@ -0,0 +1,214 @@
+package main
+
+import (
+	"backend/service"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// serveAPI runs one request against the API handlers the way the router does
+func serveAPI(as *APIServer, method string, path string, body []byte) *httptest.ResponseRecorder {
+	router := http.NewServeMux()
+	router.HandleFunc(apiPrefix+"/namespaces", makeHttpHandler(as.ServeAPINamespaces))
+	router.HandleFunc(apiPrefix+"/kinds", makeHttpHandler(as.ServeAPIKinds))
+	router.HandleFunc(apiPrefix+"/entities", makeHttpHandler(as.ServeAPIEntities))
+	router.HandleFunc(apiPrefix+"/entities/", makeHttpHandler(as.ServeAPIEntity))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+	return w
+}
+
+func TestAPIMethodNotAllowed(t *testing.T) {
+	as := &APIServer{}
+	key := datastore.NameKey("User", "alice", nil).Encode()
+	tests := []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodPost, apiPrefix + "/namespaces", "GET"},
+		{http.MethodDelete, apiPrefix + "/kinds", "GET"},
+		{http.MethodPut, apiPrefix + "/entities?kind=User", "GET"},
+		{http.MethodPost, apiPrefix + "/entities/" + key, "GET, PUT, DELETE"},
+		{http.MethodPatch, apiPrefix + "/entities/not-a-key", "GET, PUT, DELETE"},
+	}
+	for _, tt := range tests {
+		w := serveAPI(as, tt.method, tt.path, nil)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, w.Code, http.StatusMethodNotAllowed)
+		}
+		if allow := w.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("%s %s Allow = %q, want %q", tt.method, tt.path, allow, tt.allow)
+		}
+	}
+}
+
+// emulatorServer is an APIServer on the Datastore emulator, the test is
+// skipped when DATASTORE_EMULATOR_HOST does not point at one. Each test gets
+// a namespace of its own.
+func emulatorServer(t *testing.T) (*APIServer, string) {
+	t.Helper()
+	if os.Getenv("DATASTORE_EMULATOR_HOST") == "" {
+		t.Skip("DATASTORE_EMULATOR_HOST is not set")
+	}
+	project := os.Getenv("DATASTORE_PROJECT_ID")
+	if project == "" {
+		project = "api-test"
+	}
+	client, err := datastore.NewClient(context.Background(), project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return &APIServer{client: client}, fmt.Sprintf("api-test-%d", time.Now().UnixNano())
+}
+
+func TestAPIPutRoundTrip(t *testing.T) {
+	as, namespace := emulatorServer(t)
+	key := datastore.NameKey("User", "alice", nil)
+	key.Namespace = namespace
+	other := datastore.NameKey("User", "mallory", nil)
+	other.Namespace = namespace
+	friend := datastore.IDKey("User", 7, nil)
+	friend.Namespace = namespace
+
+	prop := func(name string, value interface{}, indexed bool) service.OutputProperty {
+		typeOf := fmt.Sprintf("%T", value)
+		if value == nil {
+			typeOf = service.TypeNull
+		}
+		return service.OutputProperty{Name: name, Value: value, TypeOf: typeOf, Indexed: indexed}
+	}
+	sent := service.GeneralEntity{
+		"Age":     prop("Age", int64(42), true),
+		"Score":   prop("Score", 2.0, true),
+		"Active":  prop("Active", true, true),
+		"Name":    prop("Name", "Ann", true),
+		"Notes":   prop("Notes", "long text", false),
+		"Created": prop("Created", time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC), true),
+		"Avatar":  prop("Avatar", []byte{0, 1, 2}, false),
+		"Loc":     prop("Loc", datastore.GeoPoint{Lat: 48.85, Lng: 2.35}, true),
+		"Friend":  prop("Friend", friend, true),
+		"Address": prop("Address", service.GeneralEntity{"City": prop("City", "Paris", true)}, true),
+		"Tags":    prop("Tags", []interface{}{"a", "b"}, true),
+		"Deleted": prop("Deleted", nil, true),
+		// Ignored, the key comes from the path
+		"key": prop("key", other, true),
+	}
+	body, err := json.Marshal(sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveAPI(as, http.MethodPut, apiPrefix+"/entities/"+key.Encode(), body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", w.Code, w.Body)
+	}
+	var put service.GeneralEntity
+	if err := json.Unmarshal(w.Body.Bytes(), &put); err != nil {
+		t.Fatal(err)
+	}
+
+	w = serveAPI(as, http.MethodGet, apiPrefix+"/entities/"+key.Encode(), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET = %d %s", w.Code, w.Body)
+	}
+	var got service.GeneralEntity
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, put) {
+		t.Errorf("GET = %v, want what PUT returned, %v", got, put)
+	}
+
+	if k, _ := got["key"].Value.(*datastore.Key); !k.Equal(key) {
+		t.Errorf("key = %v, want %v from the path", got["key"].Value, key)
+	}
+	delete(sent, "key")
+	for name, want := range sent {
+		p, ok := got[name]
+		switch {
+		case !ok:
+			t.Errorf("%s is missing", name)
+		case p.TypeOf != want.TypeOf || p.Indexed != want.Indexed:
+			t.Errorf("%s is %s, indexed %v, want %s, indexed %v", name, p.TypeOf, p.Indexed, want.TypeOf, want.Indexed)
+		case !sameValue(p.Value, want.Value):
+			t.Errorf("%s = %#v, want %#v", name, p.Value, want.Value)
+		}
+	}
+	if len(got) != len(sent)+1 {
+		t.Errorf("got %d properties, want %d and the key", len(got), len(sent))
+	}
+
+	if w := serveAPI(as, http.MethodGet, apiPrefix+"/entities/"+other.Encode(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET of the key in the body = %d, want %d as nothing was stored there", w.Code, http.StatusNotFound)
+	}
+
+	w = serveAPI(as, http.MethodDelete, apiPrefix+"/entities/"+key.Encode(), nil)
+	var deleted DeleteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &deleted); err != nil || w.Code != http.StatusOK || deleted.Deleted != 1 {
+		t.Errorf("DELETE = %d %s, want %d and one entity deleted", w.Code, w.Body, http.StatusOK)
+	}
+	if w := serveAPI(as, http.MethodGet, apiPrefix+"/entities/"+key.Encode(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET after DELETE = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+// sameValue compares values as they come back, times in any location and
+// nested entities by value
+func sameValue(got interface{}, want interface{}) bool {
+	switch want := want.(type) {
+	case time.Time:
+		got, ok := got.(time.Time)
+		return ok && got.Equal(want)
+	case *datastore.Key:
+		got, ok := got.(*datastore.Key)
+		return ok && got.Equal(want)
+	case service.GeneralEntity:
+		got, ok := got.(service.GeneralEntity)
+		if !ok || len(got) != len(want) {
+			return false
+		}
+		for name, p := range want {
+			if got[name].TypeOf != p.TypeOf || got[name].Indexed != p.Indexed || !sameValue(got[name].Value, p.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func TestAPIMissingEntity(t *testing.T) {
+	as, namespace := emulatorServer(t)
+	key := datastore.NameKey("User", "nobody", nil)
+	key.Namespace = namespace
+
+	w := serveAPI(as, http.MethodGet, apiPrefix+"/entities/"+key.Encode(), nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("GET = %d %s, want %d", w.Code, w.Body, http.StatusNotFound)
+	}
+	var e HttpError
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || e.Message == "" {
+		t.Errorf("body = %s, want an error message", w.Body)
+	}
+
+	if w := serveAPI(as, http.MethodDelete, apiPrefix+"/entities/"+key.Encode(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE = %d %s, want %d", w.Code, w.Body, http.StatusNotFound)
+	}
+
+	if w := serveAPI(as, http.MethodGet, apiPrefix+"/entities/not-a-key", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("GET of an invalid key = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -8,3 +8,30 @@ function showSnackbar(text) {
     x.className = x.className.replace("show", "");
   }, 1000);
 }
+
+function toggleAll(source, name) {
+  document.querySelectorAll(`input[name="${name}"]`).forEach(function (x) {
+    x.checked = source.checked;
+  });
+}
+
+// Every tab is a session of its own on the server, so tabs do not share the
+// table they show. The id lives in sessionStorage so a reloaded or reopened tab
+// finds its session again. It is taken out while the page is open and put back
+// when the page is left, so a duplicated tab, which copies sessionStorage, does
+// not find it and gets an id of its own.
+if (!window.tabId) {
+  window.tabId =
+    sessionStorage.getItem("tabId") || Date.now().toString(36) + Math.random().toString(36).slice(2);
+  sessionStorage.removeItem("tabId");
+  window.addEventListener("pagehide", function () {
+    sessionStorage.setItem("tabId", window.tabId);
+  });
+  window.addEventListener("pageshow", function () {
+    sessionStorage.removeItem("tabId");
+  });
+
+  document.addEventListener("htmx:configRequest", function (event) {
+    event.detail.headers["X-Tab-Id"] = window.tabId;
+  });
+}
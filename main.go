@@ -2,6 +2,7 @@ package main
 
 import (
 	"backend/service"
+	"backend/tui"
 	"backend/view"
 	"backend/viewmodel"
 	"context"
@@ -9,79 +10,476 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/datastore"
 )
 
 type APIServer struct {
 	listenAddr string
-	vm         *viewmodel.TableViewModel
+	client     *datastore.Client
+	sessions   *viewmodel.SessionStore
+	stats      *viewmodel.StatsCache
 }
 
-func (as *APIServer) ServeTempl(w http.ResponseWriter, r *http.Request) error {
+// ServeTempl renders the table described by the query string, see viewmodel.TableState
+func (as *APIServer) ServeTempl(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	if err := s.Table.Apply(r.Context(), viewmodel.ParseTableState(r.URL.Query())); err != nil {
+		s.Table.Error = err.Error()
+	}
+	return as.renderTable(w, r, s)
+}
 
-	entity := r.URL.Query().Get("entity")
-	sortKey := r.URL.Query().Get("sortKey")
-	page := r.URL.Query().Get("page")
+// renderTable renders the table of the session and puts its URL in the browser history
+func (as *APIServer) renderTable(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	// Messages are only shown once
+	defer s.Table.ClearMessages()
 
-	as.vm.UpdateKinds(r.Context())
+	s.Table.DebugInfo()
+
+	w.Header().Set("HX-Push-Url", s.Table.State().URL())
+	view.Show(s.Table).Render(r.Context(), w)
+	return nil
+}
 
-	if entity != "" {
-		as.vm.SelectKind(entity)
+// ServeDisplay changes how the tables of the session format values and shows the table again
+func (as *APIServer) ServeDisplay(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	if r.Method != http.MethodPost {
+		return fmt.Errorf("method %s not allowed", r.Method)
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
 	}
+	if tz := r.PostForm.Get("tz"); tz != "" {
+		if err := s.Table.Display.SetTimezone(tz); err != nil {
+			s.Table.Error = err.Error()
+		}
+	}
+	return as.renderTable(w, r, s)
+}
 
-	if as.vm.Selected == "" {
+// ServeColumns changes the column layout of the selected kind and shows the table again
+func (as *APIServer) ServeColumns(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	if r.Method != http.MethodPost {
+		return fmt.Errorf("method %s not allowed", r.Method)
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	if err := s.Table.UpdateColumns(r.PostForm.Get("action"), r.PostForm.Get("column")); err != nil {
+		s.Table.Error = err.Error()
+	}
+	return as.renderTable(w, r, s)
+}
+
+func (as *APIServer) ServeEntity(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	vm := viewmodel.NewEntityViewModel(as.client)
+	vm.Stats = as.stats
 
-		view.Show(as.vm).Render(r.Context(), w)
-		return nil
+	switch r.Method {
+	case http.MethodGet:
+		if err := vm.Load(r.Context(), r.URL.Query().Get("key")); err != nil {
+			return err
+		}
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			return err
+		}
+		if err := vm.Update(r.Context(), r.PostForm); err != nil {
+			return err
+		}
+		if vm.Message != "" {
+			s.Table.Refresh()
+		}
+	default:
+		return fmt.Errorf("method %s not allowed", r.Method)
 	}
 
-	if sortKey != "" {
-		as.vm.ToggleSortDirection()
-		as.vm.SortKey = sortKey
+	view.EntityDetail(vm, s.Table.State().URL()).Render(r.Context(), w)
+	return nil
+}
+
+// ServeReferences lists the entities that reference the key in the query string
+func (as *APIServer) ServeReferences(w http.ResponseWriter, r *http.Request) error {
+	vm := viewmodel.NewReferencesViewModel(as.client)
+	if err := vm.Load(r.Context(), r.URL.Query().Get("key")); err != nil {
+		return err
+	}
+	view.ReferencesPage(vm).Render(r.Context(), w)
+	return nil
+}
+
+func (as *APIServer) ServeNewEntity(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	if kind := r.URL.Query().Get("kind"); kind != "" && kind != s.Table.Selected {
+		s.Table.SelectKind(kind)
+	}
+
+	vm, err := s.Table.NewEntity(r.Context())
+	if err != nil {
+		return err
+	}
+
+	view.EntityDetail(vm, s.Table.State().URL()).Render(r.Context(), w)
+	return nil
+}
 
+func (as *APIServer) ServeDelete(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	if r.Method != http.MethodPost {
+		return fmt.Errorf("method %s not allowed", r.Method)
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
 	}
-	if page == "prev" && as.vm.HasPrevPage {
-		as.vm.CurrentPage -= 1
-		as.vm.HasPrevPage = as.vm.CurrentPage > 1
 
-	} else if page == "next" {
-		if as.vm.CurrentPage == as.vm.Pages {
-			as.vm.GetNewPage(r.Context())
-		} else {
+	// Stay on the current page unless the whole kind is gone
+	state := s.Table.State()
+	var err error
+	if r.URL.Path == "/delete-all" {
+		err = s.Table.DeleteAll(r.Context())
+		state.Cursor = ""
+		state.Page = 1
+	} else {
+		err = s.Table.DeleteSelected(r.Context(), r.PostForm["keys"])
+	}
+	if err != nil {
+		return err
+	}
 
-			as.vm.CurrentPage += 1
+	if err := s.Table.Apply(r.Context(), state); err != nil {
+		s.Table.Error = err.Error()
+	}
+	return as.renderTable(w, r, s)
+}
 
+func (as *APIServer) ServeGQL(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		switch r.URL.Query().Get("page") {
+		case "prev":
+			err = s.GQL.PrevPage(r.Context())
+		case "next":
+			err = s.GQL.NextPage(r.Context())
+		default:
+			s.GQL.Namespace = s.Table.Namespace
+		}
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			return err
 		}
-	} else if len(as.vm.Entities) == 0 {
-		as.vm.GetNewPage(r.Context())
+		err = s.GQL.Run(r.Context(), s.Table.Namespace, r.PostForm.Get("statement"), r.PostForm.Get("bindings"))
+	default:
+		return fmt.Errorf("method %s not allowed", r.Method)
+	}
+	if err != nil {
+		return err
+	}
 
+	view.GQLConsole(s.GQL, s.Table.State().URL()).Render(r.Context(), w)
+	return nil
+}
+
+// ServeSchema inspects the kind given in the query string, the kind of the table by default
+func (as *APIServer) ServeSchema(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	query := r.URL.Query()
+	namespace, kind := s.Table.Namespace, s.Table.Selected
+	if query.Has(viewmodel.ParamKind) {
+		namespace, kind = query.Get(viewmodel.ParamNamespace), query.Get(viewmodel.ParamKind)
+	}
+	if kind == "" {
+		return fmt.Errorf("No kind selected")
 	}
-	View := as.vm.Entities
-	if len(View) > 0 {
-		start := (as.vm.CurrentPage - 1) * as.vm.PageSize
-		end := int(math.Min(float64(as.vm.CurrentPage*as.vm.PageSize), float64(len(as.vm.Entities))))
-		View = View[start:end]
+	sample, err := strconv.Atoi(query.Get("sample"))
+	if err != nil {
+		sample = viewmodel.DefaultSchemaSample
+	}
+
+	vm := viewmodel.NewSchemaViewModel(as.client)
+	vm.Load(r.Context(), namespace, kind, sample)
+	view.SchemaPage(vm, s.Table.State().URL()).Render(r.Context(), w)
+	return nil
+}
 
-		as.vm.Headers = service.GetTableHeaders(View)
-		as.vm.View = View
+// ServeProperties lists the indexed properties of the kind given in the query string, the kind of the table by default
+func (as *APIServer) ServeProperties(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	query := r.URL.Query()
+	namespace, kind := s.Table.Namespace, s.Table.Selected
+	if query.Has(viewmodel.ParamNamespace) || query.Has(viewmodel.ParamKind) {
+		namespace, kind = query.Get(viewmodel.ParamNamespace), query.Get(viewmodel.ParamKind)
 	}
 
-	as.vm.DebugInfo()
+	vm := viewmodel.NewPropertiesViewModel(as.client)
+	vm.Load(r.Context(), namespace, kind)
+	view.PropertiesPage(vm, s.Table.State().URL()).Render(r.Context(), w)
+	return nil
+}
 
-	view.Show(as.vm).Render(r.Context(), w)
+// ServeIndexes lists the queries of the session that production would reject for
+// a missing composite index. Posting loads or reloads index.yaml.
+func (as *APIServer) ServeIndexes(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	var message, errMessage string
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			return err
+		}
+		var err error
+		if message, err = s.Table.UpdateIndexes(r.PostForm.Get("action"), r.PostForm.Get("path")); err != nil {
+			errMessage = err.Error()
+		}
+	}
+
+	vm := viewmodel.NewIndexesViewModel(s.Table)
+	vm.Message, vm.Error = message, errMessage
+	view.IndexesPage(vm, s.Table.State().URL()).Render(r.Context(), w)
+	return nil
+}
+
+// ServeTree shows the root keys of the kind given in the query string, the kind of the table by default
+func (as *APIServer) ServeTree(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	query := r.URL.Query()
+	namespace, kind := s.Table.Namespace, s.Table.Selected
+	if query.Has(viewmodel.ParamKind) {
+		namespace, kind = query.Get(viewmodel.ParamNamespace), query.Get(viewmodel.ParamKind)
+	}
+	if kind == "" {
+		return fmt.Errorf("No kind selected")
+	}
+
+	vm := viewmodel.NewTreeViewModel(as.client)
+	if err := vm.Load(r.Context(), namespace, kind, query.Get(viewmodel.ParamCursor)); err != nil {
+		return err
+	}
+	view.TreePage(vm, s.Table.State().URL()).Render(r.Context(), w)
+	return nil
+}
+
+func (as *APIServer) ServeTreeChildren(w http.ResponseWriter, r *http.Request) error {
+	node, err := viewmodel.NewTreeViewModel(as.client).Children(r.Context(), r.URL.Query().Get("key"))
+	if err != nil {
+		return err
+	}
+	view.TreeChildren(node).Render(r.Context(), w)
+	return nil
+}
+
+// maxImportMemory is how much of an uploaded file is kept in memory, the rest goes to disk
+const maxImportMemory = 32 << 20
+
+func (as *APIServer) ServeImport(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	s.Jobs.Lock()
+	defer s.Jobs.Unlock()
+	vm := s.Jobs.Import
+	switch r.Method {
+	case http.MethodGet:
+		if !vm.Progress().Running {
+			vm.Namespace = s.Table.Namespace
+			vm.Kind = s.Table.Selected
+		}
+	case http.MethodPost:
+		if err := r.ParseMultipartForm(maxImportMemory); err != nil {
+			return err
+		}
+		vm.Namespace = r.FormValue("namespace")
+		vm.Kind = r.FormValue("kind")
+		vm.Format = r.FormValue("format")
+		vm.Types = r.FormValue("types")
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return fmt.Errorf("no file uploaded")
+		}
+		defer file.Close()
+		vm.Start(r.Context(), file, header.Filename, r.FormValue("dryRun") != "")
+	default:
+		return fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	view.ImportPage(vm, vm.Progress(), s.Table.State().URL()).Render(r.Context(), w)
+	return nil
+}
+
+// ServeImportBackup opens a managed export ("open") or loads entities from it ("load")
+func (as *APIServer) ServeImportBackup(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	if r.Method != http.MethodPost {
+		return fmt.Errorf("method %s not allowed", r.Method)
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+
+	s.Jobs.Lock()
+	defer s.Jobs.Unlock()
+	vm := s.Jobs.Import
+	if r.PostForm.Get("action") == "load" {
+		vm.StartBackup(r.Context(), r.PostForm["kinds"], r.PostForm["namespaces"])
+	} else {
+		vm.OpenBackup(r.PostForm.Get("dir"))
+	}
+
+	view.ImportPage(vm, vm.Progress(), s.Table.State().URL()).Render(r.Context(), w)
+	return nil
+}
+
+func (as *APIServer) ServeImportProgress(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	progress := s.Jobs.Import.Progress()
+	if !progress.Running {
+		// Show the imported entities next time the table is opened
+		s.Table.Refresh()
+	}
+	view.ImportProgress(progress).Render(r.Context(), w)
+	return nil
+}
+
+// ServeStats lists the stats of every kind, POST scans one kind or, without a kind, all of them
+func (as *APIServer) ServeStats(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	rows, err := s.Jobs.Stats.Rows(r.Context())
+	if err != nil {
+		return err
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			return err
+		}
+		scan := rows
+		if kind := r.PostForm.Get(viewmodel.ParamKind); kind != "" {
+			namespace := r.PostForm.Get(viewmodel.ParamNamespace)
+			scan = []viewmodel.StatsRow{{Namespace: namespace, Kind: kind}}
+		}
+		s.Jobs.Lock()
+		s.Jobs.Stats.StartScan(r.Context(), scan)
+		s.Jobs.Unlock()
+	default:
+		return fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	view.StatsPage(rows, s.Jobs.Stats.Progress(), s.Table.State().URL()).Render(r.Context(), w)
+	return nil
+}
+
+func (as *APIServer) ServeStatsProgress(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error {
+	view.StatsProgress(s.Jobs.Stats.Progress(), true).Render(r.Context(), w)
+	return nil
+}
+
+// exportContentTypes maps each of service.ExportFormats to its media type
+var exportContentTypes = map[string]string{
+	service.FormatJSONLines: "application/jsonl",
+	service.FormatNDJSON:    "application/x-ndjson",
+	service.FormatCSV:       "text/csv",
+}
+
+// ServeExport downloads every result of the table query in the query string, or
+// of the GQL statement in ?gql= with the bindings in ?bindings=
+func (as *APIServer) ServeExport(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return fmt.Errorf("method %s not allowed", r.Method)
+	}
+	q := r.URL.Query()
+	format := q.Get("format")
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+
+	state := viewmodel.ParseTableState(q)
+	var query *datastore.Query
+	var offset, limit int
+	name := state.Kind
+	if statement := q.Get("gql"); statement != "" {
+		bindings, err := service.ParseGQLBindings(q.Get("bindings"), state.Namespace)
+		if err != nil {
+			return err
+		}
+		gql, err := service.ParseGQL(statement, state.Namespace, bindings)
+		if err != nil {
+			return err
+		}
+		query, offset, limit, name = gql.Query, gql.Offset, gql.Limit, gql.Kind
+	} else {
+		if state.Kind == "" {
+			return fmt.Errorf("kind is required")
+		}
+		var err error
+		if query, err = state.Query(0).Build(); err != nil {
+			return err
+		}
+	}
+	if name == "" {
+		name = "entities"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+format))
+	count, err := service.Export(r.Context(), as.client, query, offset, limit, format, w)
+	if err != nil {
+		// The file is already under way, all we can do is cut it short
+		log.Printf("export of %s stopped after %d entities: %s", name, count, err)
+	}
 	return nil
 }
 
 type ApiFunc func(w http.ResponseWriter, r *http.Request) error
+type SessionFunc func(w http.ResponseWriter, r *http.Request, s *viewmodel.Session) error
+
+const sessionCookie = "dsui_session"
+
+// tabHeader carries the id js/common.js gives every page load, so each tab has
+// its own session
+const tabHeader = "X-Tab-Id"
+
+// withSession runs f with the session of the requesting browser, locked for the
+// duration of the request
+func (as *APIServer) withSession(f SessionFunc) ApiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		id := ""
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			id = c.Value
+		}
+		id, s, created := as.sessions.Get(id, r.Header.Get(tabHeader))
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    id,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		s.Lock()
+		defer s.Unlock()
+		if created && r.URL.Path != "/" {
+			as.restoreTable(r, s)
+		}
+		return f(w, r, s)
+	}
+}
+
+// restoreTable shows the table of the page the request comes from in a new
+// session, as handlers other than the table itself act on the table shown. The
+// table applies its own URL, so it needs none.
+func (as *APIServer) restoreTable(r *http.Request, s *viewmodel.Session) {
+	current, err := url.Parse(r.Header.Get("HX-Current-URL"))
+	if err != nil || current.Path != "/" {
+		return
+	}
+	if err := s.Table.Apply(r.Context(), viewmodel.ParseTableState(current.Query())); err != nil {
+		s.Table.Error = err.Error()
+	}
+}
+
 type HttpError struct {
 	Message string `json:"message"`
 }
 
 func WriteJSON(w http.ResponseWriter, status int, value any) {
-	w.WriteHeader(status)
 	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(value)
 }
 func makeHttpHandler(f ApiFunc) http.HandlerFunc {
@@ -90,7 +488,7 @@ func makeHttpHandler(f ApiFunc) http.HandlerFunc {
 
 		fmt.Println("\n\n---------------------------------------------")
 		fmt.Println(r.Method, r.URL.Path)
-		fmt.Println("---------------------------------------------]\n")
+		fmt.Print("---------------------------------------------]\n\n")
 
 		if err := f(w, r); err != nil {
 			WriteJSON(w, http.StatusBadRequest, HttpError{
@@ -101,7 +499,7 @@ func makeHttpHandler(f ApiFunc) http.HandlerFunc {
 }
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage of %s: [flags] [tui]\n", os.Args[0])
 	flag.PrintDefaults()
 }
 
@@ -111,6 +509,9 @@ func main() {
 	emulatorHost := flag.String("emuHost", "localhost:8081", "Host for the emulator")
 	emulatorHostPath := flag.String("emuHostPath", "localhost:8081/datastore", "Host path for the emulator")
 	datastoreHost := flag.String("dsHost", "http://localhost:8081", "Host for the datastore")
+	sessionIdle := flag.Duration("sessionIdle", 30*time.Minute, "Idle time after which a browser session is dropped")
+	indexYaml := flag.String("indexYaml", "", "index.yaml whose composite indexes the queries of the table are checked against, can also be loaded on the Indexes page")
+	layoutsPath := flag.String("layouts", viewmodel.DefaultLayoutsPath(), "File the column layouts of every kind are saved in")
 
 	flag.Usage = usage
 
@@ -122,17 +523,37 @@ func main() {
 	os.Setenv("DATASTORE_HOST", *datastoreHost)
 	os.Setenv("DATASTORE_PROJECT_ID", *projectId)
 
-	fmt.Println("Starting server on port:", port)
-
 	ctx := context.Background()
 	client, err := service.NewDatastoreClient(ctx)
 	if err != nil {
 		log.Fatalf("Failed to create client: %v", err)
 	}
 
-	vm := viewmodel.NewTableViewModel(client)
+	// The tui command browses the emulator from the terminal instead of serving the web UI
+	if flag.Arg(0) == "tui" {
+		if err := tui.Run(ctx, client); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	fmt.Println("Starting server on port:", port)
+
+	layouts, err := viewmodel.NewLayoutStore(*layoutsPath, *projectId)
+	if err != nil {
+		log.Printf("Column layouts not loaded, changes are kept until restart: %v", err)
+	}
+
+	indexes, err := viewmodel.NewIndexCheck(*indexYaml)
+	if err != nil {
+		log.Fatalf("Failed to load index.yaml: %v", err)
+	}
+
+	stats := viewmodel.NewStatsCache()
+	sessions := viewmodel.NewSessionStore(client, layouts, indexes, stats, *sessionIdle)
+	go sessions.ExpireEvery(ctx, time.Minute)
 
-	as := APIServer{vm: vm}
+	as := APIServer{client: client, sessions: sessions, stats: stats}
 
 	router := http.NewServeMux()
 
@@ -140,7 +561,31 @@ func main() {
 	router.Handle("/vendor-js/", http.StripPrefix("/vendor-js/", http.FileServer(http.Dir("./vendor-js"))))
 	router.Handle("/js/", http.StripPrefix("/js/", http.FileServer(http.Dir("./js"))))
 
-	router.HandleFunc("/", makeHttpHandler(as.ServeTempl))
+	router.HandleFunc("/", makeHttpHandler(as.withSession(as.ServeTempl)))
+	router.HandleFunc("/display", makeHttpHandler(as.withSession(as.ServeDisplay)))
+	router.HandleFunc("/columns", makeHttpHandler(as.withSession(as.ServeColumns)))
+	router.HandleFunc("/entity", makeHttpHandler(as.withSession(as.ServeEntity)))
+	router.HandleFunc("/references", makeHttpHandler(as.ServeReferences))
+	router.HandleFunc("/entity/new", makeHttpHandler(as.withSession(as.ServeNewEntity)))
+	router.HandleFunc("/delete", makeHttpHandler(as.withSession(as.ServeDelete)))
+	router.HandleFunc("/delete-all", makeHttpHandler(as.withSession(as.ServeDelete)))
+	router.HandleFunc("/gql", makeHttpHandler(as.withSession(as.ServeGQL)))
+	router.HandleFunc("/schema", makeHttpHandler(as.withSession(as.ServeSchema)))
+	router.HandleFunc("/stats", makeHttpHandler(as.withSession(as.ServeStats)))
+	router.HandleFunc("/stats/progress", makeHttpHandler(as.withSession(as.ServeStatsProgress)))
+	router.HandleFunc("/properties", makeHttpHandler(as.withSession(as.ServeProperties)))
+	router.HandleFunc("/indexes", makeHttpHandler(as.withSession(as.ServeIndexes)))
+	router.HandleFunc("/tree", makeHttpHandler(as.withSession(as.ServeTree)))
+	router.HandleFunc("/tree/children", makeHttpHandler(as.ServeTreeChildren))
+	router.HandleFunc("/export", makeHttpHandler(as.ServeExport))
+	router.HandleFunc("/import", makeHttpHandler(as.withSession(as.ServeImport)))
+	router.HandleFunc("/import/backup", makeHttpHandler(as.withSession(as.ServeImportBackup)))
+	router.HandleFunc("/import/progress", makeHttpHandler(as.withSession(as.ServeImportProgress)))
+
+	router.HandleFunc(apiPrefix+"/namespaces", makeHttpHandler(as.ServeAPINamespaces))
+	router.HandleFunc(apiPrefix+"/kinds", makeHttpHandler(as.ServeAPIKinds))
+	router.HandleFunc(apiPrefix+"/entities", makeHttpHandler(as.ServeAPIEntities))
+	router.HandleFunc(apiPrefix+"/entities/", makeHttpHandler(as.ServeAPIEntity))
 	http.ListenAndServe("localhost:8080", router)
 
 }
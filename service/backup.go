@@ -0,0 +1,525 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Backup is a managed export ("gcloud datastore export") in a local directory:
+// an .overall_export_metadata file next to one kind_<Kind> directory per kind,
+// holding LevelDB log files (output-0, output-1, ...) of App Engine EntityProtos
+type Backup struct {
+	Dir   string
+	files map[string][]string // output files per kind
+}
+
+// BackupKind counts the entities of a kind in a backup per namespace
+type BackupKind struct {
+	Kind       string
+	Namespaces map[string]int
+}
+
+// OpenBackup finds the output files of every kind of the export in dir
+func OpenBackup(dir string) (*Backup, error) {
+	metadata, err := filepath.Glob(filepath.Join(dir, "*.overall_export_metadata"))
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata) == 0 {
+		return nil, fmt.Errorf("%s has no .overall_export_metadata file, it is not a Datastore export", dir)
+	}
+
+	b := &Backup{Dir: dir, files: map[string][]string{}}
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasPrefix(d.Name(), "output-") {
+			return nil
+		}
+		kind, ok := strings.CutPrefix(filepath.Base(filepath.Dir(path)), "kind_")
+		if !ok {
+			return nil
+		}
+		b.files[kind] = append(b.files[kind], path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(b.files) == 0 {
+		return nil, fmt.Errorf("%s has no kind_<Kind>/output-* files", dir)
+	}
+	return b, nil
+}
+
+func (b *Backup) Kinds() []string {
+	kinds := make([]string, 0, len(b.files))
+	for kind := range b.files {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Scan reads the whole backup and counts the entities of every kind per namespace
+func (b *Backup) Scan() ([]BackupKind, error) {
+	var kinds []BackupKind
+	for _, kind := range b.Kinds() {
+		bk := BackupKind{Kind: kind, Namespaces: map[string]int{}}
+		err := b.each(kind, func(key *datastore.Key, _ GeneralEntity) error {
+			bk.Namespaces[key.Namespace]++
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, bk)
+	}
+	return kinds, nil
+}
+
+// Each calls fn for every entity of the given kinds whose namespace is one of
+// namespaces, or in any namespace when namespaces is empty
+func (b *Backup) Each(kinds []string, namespaces []string, fn func(key *datastore.Key, entity GeneralEntity) error) error {
+	for _, kind := range kinds {
+		if _, ok := b.files[kind]; !ok {
+			return fmt.Errorf("the backup has no kind %s", kind)
+		}
+		err := b.each(kind, func(key *datastore.Key, entity GeneralEntity) error {
+			if len(namespaces) > 0 && !slices.Contains(namespaces, key.Namespace) {
+				return nil
+			}
+			return fn(key, entity)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backup) each(kind string, fn func(key *datastore.Key, entity GeneralEntity) error) error {
+	for _, path := range b.files[kind] {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = readLevelDBLog(f, func(record []byte) error {
+			key, entity, err := decodeEntityProto(record)
+			if err != nil {
+				return err
+			}
+			if key == nil {
+				return fmt.Errorf("entity without key")
+			}
+			return fn(key, entity)
+		})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	return nil
+}
+
+// LoadBackup writes the selected entities of a backup with PutMulti in batches,
+// progress is called with the number of entities done so far
+func LoadBackup(ctx context.Context, client *datastore.Client, b *Backup, kinds []string, namespaces []string, progress func(done int)) (int, []RowError, error) {
+	written, done := 0, 0
+	var rowErrors []RowError
+	var batch []ImportRow
+	flush := func() {
+		n, errs := ImportEntities(ctx, client, batch, func(int) {})
+		written += n
+		for _, e := range errs {
+			// Backups have no lines to point at, name the entity instead
+			e.Message = batch[e.Line-batch[0].Line].Key.String() + ": " + e.Message
+			rowErrors = append(rowErrors, e)
+		}
+		done += len(batch)
+		batch = batch[:0]
+		progress(done)
+	}
+	err := b.Each(kinds, namespaces, func(key *datastore.Key, entity GeneralEntity) error {
+		batch = append(batch, ImportRow{Line: done + len(batch) + 1, Key: key, Entity: entity})
+		if len(batch) == importBatchSize {
+			flush()
+		}
+		return ctx.Err()
+	})
+	if err == nil && len(batch) > 0 {
+		flush()
+	}
+	return written, rowErrors, err
+}
+
+// LevelDB log format: 32KiB blocks of records, each with a 7 byte header of
+// masked CRC-32C, little endian length and type. Records that do not fit in a
+// block are split into first, middle and last fragments.
+const (
+	logBlockSize  = 32 * 1024
+	logHeaderSize = 7
+
+	logFull   = 1
+	logFirst  = 2
+	logMiddle = 3
+	logLast   = 4
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+func readLevelDBLog(r io.Reader, fn func(record []byte) error) error {
+	block := make([]byte, logBlockSize)
+	var record []byte
+	inRecord := false
+	for {
+		n, err := io.ReadFull(r, block)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		data := block[:n]
+
+		for len(data) >= logHeaderSize {
+			checksum := binary.LittleEndian.Uint32(data[0:4])
+			length := int(binary.LittleEndian.Uint16(data[4:6]))
+			typ := data[6]
+			if typ == 0 && length == 0 {
+				// Zero padding at the end of a block
+				break
+			}
+			if logHeaderSize+length > len(data) {
+				return fmt.Errorf("corrupt log record")
+			}
+			payload := data[logHeaderSize : logHeaderSize+length]
+			if unmaskCRC(checksum) != crc32.Update(crc32.Checksum(data[6:7], crc32c), crc32c, payload) {
+				return fmt.Errorf("log record checksum mismatch")
+			}
+			data = data[logHeaderSize+length:]
+
+			switch typ {
+			case logFull:
+				if err := fn(payload); err != nil {
+					return err
+				}
+			case logFirst:
+				record = append(record[:0], payload...)
+				inRecord = true
+			case logMiddle, logLast:
+				if !inRecord {
+					return fmt.Errorf("log record fragment without a start")
+				}
+				record = append(record, payload...)
+				if typ == logLast {
+					inRecord = false
+					if err := fn(record); err != nil {
+						return err
+					}
+				}
+			default:
+				return fmt.Errorf("unknown log record type %d", typ)
+			}
+		}
+		if n < logBlockSize {
+			return nil
+		}
+	}
+}
+
+func unmaskCRC(masked uint32) uint32 {
+	rot := masked - 0xa282ead8
+	return rot>>17 | rot<<15
+}
+
+// Field numbers and meanings of the App Engine datastore_v3 EntityProto
+const (
+	entityKey         = 13
+	entityProperty    = 14
+	entityRawProperty = 15
+
+	referenceNamespace = 20
+	referencePath      = 14
+	pathElement        = 1
+	elementType        = 2
+	elementID          = 3
+	elementName        = 4
+
+	propertyMeaning  = 1
+	propertyName     = 3
+	propertyMultiple = 4
+	propertyValue    = 5
+
+	valueInt64         = 1
+	valueBool          = 2
+	valueString        = 3
+	valueDouble        = 4
+	valuePoint         = 5
+	valuePointX        = 6
+	valuePointY        = 7
+	valueUser          = 8
+	valueUserEmail     = 9
+	valueReference     = 12
+	valueRefNamespace  = 20
+	valueRefElement    = 14
+	valueRefElemType   = 15
+	valueRefElemID     = 16
+	valueRefElemName   = 17
+	meaningGDWhen      = 7
+	meaningBlob        = 14
+	meaningByteString  = 16
+	meaningEntityProto = 19
+	meaningEmptyList   = 24
+)
+
+// protoField is one field of a protobuf message, groups hold their contents in Bytes
+type protoField struct {
+	Num    protowire.Number
+	Varint uint64
+	Bytes  []byte
+}
+
+func protoFields(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		f := protoField{Num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.Varint, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.Varint, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			f.Varint = uint64(v)
+		case protowire.BytesType:
+			f.Bytes, n = protowire.ConsumeBytes(b)
+		case protowire.StartGroupType:
+			f.Bytes, n = protowire.ConsumeGroup(num, b)
+		default:
+			return nil, fmt.Errorf("unexpected wire type %d", typ)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func decodeEntityProto(b []byte) (*datastore.Key, GeneralEntity, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	var key *datastore.Key
+	entity := GeneralEntity{}
+	for _, f := range fields {
+		switch f.Num {
+		case entityKey:
+			if key, err = decodeKey(f.Bytes); err != nil {
+				return nil, nil, err
+			}
+		case entityProperty, entityRawProperty:
+			if err := decodeProperty(f.Bytes, f.Num == entityProperty, entity); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return key, entity, nil
+}
+
+// decodeKey reads the Reference of an entity, its path is a Path message
+func decodeKey(b []byte) (*datastore.Key, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	namespace := ""
+	var elements [][]byte
+	for _, f := range fields {
+		switch f.Num {
+		case referenceNamespace:
+			namespace = string(f.Bytes)
+		case referencePath:
+			path, err := protoFields(f.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range path {
+				if e.Num == pathElement {
+					elements = append(elements, e.Bytes)
+				}
+			}
+		}
+	}
+	return keyFromPath(namespace, elements, elementType, elementID, elementName)
+}
+
+// decodeKeyValue reads the ReferenceValue of a key property, its path elements
+// are groups of the value itself
+func decodeKeyValue(b []byte) (*datastore.Key, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	namespace := ""
+	var elements [][]byte
+	for _, f := range fields {
+		switch f.Num {
+		case valueRefNamespace:
+			namespace = string(f.Bytes)
+		case valueRefElement:
+			elements = append(elements, f.Bytes)
+		}
+	}
+	return keyFromPath(namespace, elements, valueRefElemType, valueRefElemID, valueRefElemName)
+}
+
+func keyFromPath(namespace string, elements [][]byte, typeNum, idNum, nameNum protowire.Number) (*datastore.Key, error) {
+	var key *datastore.Key
+	for _, element := range elements {
+		fields, err := protoFields(element)
+		if err != nil {
+			return nil, err
+		}
+		k := &datastore.Key{Parent: key, Namespace: namespace}
+		for _, f := range fields {
+			switch f.Num {
+			case typeNum:
+				k.Kind = string(f.Bytes)
+			case idNum:
+				k.ID = int64(f.Varint)
+			case nameNum:
+				k.Name = string(f.Bytes)
+			}
+		}
+		key = k
+	}
+	return key, nil
+}
+
+// decodeProperty adds a property to entity, the elements of an array are
+// separate properties with the multiple flag set
+func decodeProperty(b []byte, indexed bool, entity GeneralEntity) error {
+	fields, err := protoFields(b)
+	if err != nil {
+		return err
+	}
+	var name string
+	var meaning uint64
+	var multiple bool
+	var raw []byte
+	for _, f := range fields {
+		switch f.Num {
+		case propertyMeaning:
+			meaning = f.Varint
+		case propertyName:
+			name = string(f.Bytes)
+		case propertyMultiple:
+			multiple = f.Varint != 0
+		case propertyValue:
+			raw = f.Bytes
+		}
+	}
+
+	value, err := decodePropertyValue(raw, meaning)
+	if err != nil {
+		return fmt.Errorf("property %s: %s", name, err)
+	}
+	if meaning == meaningEmptyList {
+		value = []interface{}{}
+	} else if multiple {
+		items, _ := entity[name].Value.([]interface{})
+		value = append(items, value)
+	}
+	entity[name] = OutputProperty{
+		Name:    name,
+		Value:   value,
+		TypeOf:  fmt.Sprintf("%T", value),
+		Indexed: indexed,
+	}
+	return nil
+}
+
+func decodePropertyValue(b []byte, meaning uint64) (interface{}, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		switch f.Num {
+		case valueInt64:
+			if meaning == meaningGDWhen {
+				return time.UnixMicro(int64(f.Varint)).UTC(), nil
+			}
+			return int64(f.Varint), nil
+		case valueBool:
+			return f.Varint != 0, nil
+		case valueDouble:
+			return math.Float64frombits(f.Varint), nil
+		case valueString:
+			switch meaning {
+			case meaningBlob, meaningByteString:
+				return bytes.Clone(f.Bytes), nil
+			case meaningEntityProto:
+				_, nested, err := decodeEntityProto(f.Bytes)
+				return nested, err
+			default:
+				return string(f.Bytes), nil
+			}
+		case valuePoint:
+			point, err := protoFields(f.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			var p datastore.GeoPoint
+			for _, c := range point {
+				switch c.Num {
+				case valuePointX:
+					p.Lat = math.Float64frombits(c.Varint)
+				case valuePointY:
+					p.Lng = math.Float64frombits(c.Varint)
+				}
+			}
+			return p, nil
+		case valueUser:
+			// Users have no Cloud Datastore type, keep the email address
+			user, err := protoFields(f.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range user {
+				if c.Num == valueUserEmail {
+					return string(c.Bytes), nil
+				}
+			}
+			return "", nil
+		case valueReference:
+			return decodeKeyValue(f.Bytes)
+		}
+	}
+	return nil, nil
+}
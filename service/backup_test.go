@@ -0,0 +1,304 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// logRecord frames payload as one LevelDB log record of type typ
+func logRecord(typ byte, payload []byte) []byte {
+	header := make([]byte, logHeaderSize)
+	crc := crc32.Update(crc32.Checksum([]byte{typ}, crc32c), crc32c, payload)
+	binary.LittleEndian.PutUint32(header[0:4], (crc>>15|crc<<17)+0xa282ead8)
+	binary.LittleEndian.PutUint16(header[4:6], uint16(len(payload)))
+	header[6] = typ
+	return append(header, payload...)
+}
+
+// writeLevelDBLog frames records the way LevelDB does: fragments where a record
+// crosses a block and zero padding where a block has no room for a header
+func writeLevelDBLog(records ...[]byte) []byte {
+	var out []byte
+	for _, record := range records {
+		first := true
+		for {
+			left := logBlockSize - len(out)%logBlockSize
+			if left < logHeaderSize {
+				out = append(out, make([]byte, left)...)
+				left = logBlockSize
+			}
+			n := min(len(record), left-logHeaderSize)
+			last := n == len(record)
+			var typ byte
+			switch {
+			case first && last:
+				typ = logFull
+			case first:
+				typ = logFirst
+			case last:
+				typ = logLast
+			default:
+				typ = logMiddle
+			}
+			out = append(out, logRecord(typ, record[:n])...)
+			record = record[n:]
+			first = false
+			if last {
+				break
+			}
+		}
+	}
+	return out
+}
+
+func readAllRecords(data []byte) ([][]byte, error) {
+	var records [][]byte
+	err := readLevelDBLog(bytes.NewReader(data), func(record []byte) error {
+		records = append(records, bytes.Clone(record))
+		return nil
+	})
+	return records, err
+}
+
+func TestReadLevelDBLog(t *testing.T) {
+	filled := func(n int, c byte) []byte { return bytes.Repeat([]byte{c}, n) }
+	tests := []struct {
+		name    string
+		records [][]byte
+	}{
+		{"empty log", nil},
+		{"full records", [][]byte{[]byte("one"), []byte("two"), {}}},
+		{"split across two blocks", [][]byte{[]byte("before"), filled(40000, 'a'), []byte("after")}},
+		{"split across three blocks", [][]byte{filled(70000, 'b')}},
+		// Leaves 3 bytes at the end of the first block, too few for a header
+		{"block padding", [][]byte{filled(logBlockSize-logHeaderSize-3, 'c'), []byte("next block")}},
+		{"record ending a block", [][]byte{filled(logBlockSize-logHeaderSize, 'd'), []byte("next block")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readAllRecords(writeLevelDBLog(tt.records...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.records) {
+				t.Fatalf("read %d records, want %d", len(got), len(tt.records))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.records[i]) {
+					t.Errorf("record %d has %d bytes, want %d", i, len(got[i]), len(tt.records[i]))
+				}
+			}
+		})
+	}
+}
+
+func TestReadLevelDBLogFragments(t *testing.T) {
+	data := writeLevelDBLog(bytes.Repeat([]byte{'x'}, 70000))
+	types := []byte{data[6], data[logBlockSize+6], data[2*logBlockSize+6]}
+	if !bytes.Equal(types, []byte{logFirst, logMiddle, logLast}) {
+		t.Errorf("fragment types = %v, want first, middle, last", types)
+	}
+}
+
+func TestReadLevelDBLogErrors(t *testing.T) {
+	corrupt := writeLevelDBLog([]byte("payload"))
+	corrupt[logHeaderSize] ^= 0xff
+
+	truncated := writeLevelDBLog([]byte("payload"))
+	truncated = truncated[:len(truncated)-2]
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"checksum mismatch", corrupt, "checksum mismatch"},
+		{"fragment without a start", logRecord(logLast, []byte("tail")), "fragment without a start"},
+		{"unknown type", logRecord(9, []byte("x")), "unknown log record type 9"},
+		{"length past the data", truncated, "corrupt log record"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readAllRecords(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// EntityProto builders, field numbers are those decodeEntityProto reads
+
+func protoBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func protoVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func protoFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func protoGroup(b []byte, num protowire.Number, contents []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.StartGroupType)
+	b = append(b, contents...)
+	return protowire.AppendTag(b, num, protowire.EndGroupType)
+}
+
+// testElement is a key path element with either an ID or a name
+type testElement struct {
+	kind string
+	id   int64
+	name string
+}
+
+func protoElement(typeNum, idNum, nameNum protowire.Number, e testElement) []byte {
+	b := protoBytes(nil, typeNum, []byte(e.kind))
+	if e.name != "" {
+		return protoBytes(b, nameNum, []byte(e.name))
+	}
+	return protoVarint(b, idNum, uint64(e.id))
+}
+
+func protoReference(namespace string, path ...testElement) []byte {
+	var elements []byte
+	for _, e := range path {
+		elements = protoGroup(elements, pathElement, protoElement(elementType, elementID, elementName, e))
+	}
+	b := protoBytes(nil, referenceNamespace, []byte(namespace))
+	return protoBytes(b, referencePath, elements)
+}
+
+func protoReferenceValue(namespace string, path ...testElement) []byte {
+	b := protoBytes(nil, valueRefNamespace, []byte(namespace))
+	for _, e := range path {
+		b = protoGroup(b, valueRefElement, protoElement(valueRefElemType, valueRefElemID, valueRefElemName, e))
+	}
+	return b
+}
+
+// protoProperty is an indexed or unindexed property of an EntityProto
+func protoProperty(b []byte, indexed bool, name string, meaning uint64, multiple bool, value []byte) []byte {
+	var p []byte
+	if meaning != 0 {
+		p = protoVarint(p, propertyMeaning, meaning)
+	}
+	p = protoBytes(p, propertyName, []byte(name))
+	if multiple {
+		p = protoVarint(p, propertyMultiple, 1)
+	}
+	p = protoBytes(p, propertyValue, value)
+	field := protowire.Number(entityProperty)
+	if !indexed {
+		field = entityRawProperty
+	}
+	return protoBytes(b, field, p)
+}
+
+func testProperty(name string, value interface{}, indexed bool) OutputProperty {
+	return OutputProperty{Name: name, Value: value, TypeOf: fmt.Sprintf("%T", value), Indexed: indexed}
+}
+
+func TestDecodeEntityProto(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC)
+	point := func(lat, lng float64) []byte {
+		b := protoFixed64(nil, valuePointX, math.Float64bits(lat))
+		return protoFixed64(b, valuePointY, math.Float64bits(lng))
+	}
+
+	nested := protoProperty(nil, true, "City", 0, false, protoBytes(nil, valueString, []byte("Paris")))
+	nested = protoProperty(nested, false, "Zip", 0, false, protoVarint(nil, valueInt64, 75000))
+
+	var b []byte
+	b = protoBytes(b, entityKey, protoReference("ns", testElement{kind: "User", name: "alice"}, testElement{kind: "Order", id: 7}))
+	b = protoProperty(b, true, "Count", 0, false, protoVarint(nil, valueInt64, uint64(math.MaxUint64))) // -1
+	b = protoProperty(b, true, "Active", 0, false, protoVarint(nil, valueBool, 1))
+	b = protoProperty(b, true, "Name", 0, false, protoBytes(nil, valueString, []byte("Ann")))
+	b = protoProperty(b, true, "Score", 0, false, protoFixed64(nil, valueDouble, math.Float64bits(2.5)))
+	b = protoProperty(b, true, "Created", meaningGDWhen, false, protoVarint(nil, valueInt64, uint64(created.UnixMicro())))
+	b = protoProperty(b, false, "Avatar", meaningBlob, false, protoBytes(nil, valueString, []byte{0, 1, 2}))
+	b = protoProperty(b, true, "Hash", meaningByteString, false, protoBytes(nil, valueString, []byte{9, 8}))
+	b = protoProperty(b, true, "Loc", 0, false, protoGroup(nil, valuePoint, point(48.85, 2.35)))
+	b = protoProperty(b, true, "Owner", 0, false, protoGroup(nil, valueUser, protoBytes(nil, valueUserEmail, []byte("ann@example.com"))))
+	b = protoProperty(b, true, "Friend", 0, false, protoGroup(nil, valueReference,
+		protoReferenceValue("ns", testElement{kind: "User", name: "bob"}, testElement{kind: "Order", id: 3})))
+	b = protoProperty(b, false, "Address", meaningEntityProto, false, protoBytes(nil, valueString, nested))
+	b = protoProperty(b, true, "Tags", 0, true, protoBytes(nil, valueString, []byte("a")))
+	b = protoProperty(b, true, "Tags", 0, true, protoBytes(nil, valueString, []byte("b")))
+	b = protoProperty(b, true, "None", meaningEmptyList, false, nil)
+	b = protoProperty(b, true, "Deleted", 0, false, nil)
+	b = protoProperty(b, false, "Notes", 0, false, protoBytes(nil, valueString, []byte("long text")))
+
+	// Through the log framing, as the backup files hold them
+	records, err := readAllRecords(writeLevelDBLog(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, entity, err := decodeEntityProto(records[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &datastore.Key{Kind: "User", Name: "alice", Namespace: "ns"}
+	wantKey := &datastore.Key{Kind: "Order", ID: 7, Parent: alice, Namespace: "ns"}
+	if !reflect.DeepEqual(key, wantKey) {
+		t.Errorf("key = %v, want %v", key, wantKey)
+	}
+
+	bob := &datastore.Key{Kind: "User", Name: "bob", Namespace: "ns"}
+	want := GeneralEntity{
+		"Count":   testProperty("Count", int64(-1), true),
+		"Active":  testProperty("Active", true, true),
+		"Name":    testProperty("Name", "Ann", true),
+		"Score":   testProperty("Score", 2.5, true),
+		"Created": testProperty("Created", created, true),
+		"Avatar":  testProperty("Avatar", []byte{0, 1, 2}, false),
+		"Hash":    testProperty("Hash", []byte{9, 8}, true),
+		"Loc":     testProperty("Loc", datastore.GeoPoint{Lat: 48.85, Lng: 2.35}, true),
+		"Owner":   testProperty("Owner", "ann@example.com", true),
+		"Friend":  testProperty("Friend", &datastore.Key{Kind: "Order", ID: 3, Parent: bob, Namespace: "ns"}, true),
+		"Address": testProperty("Address", GeneralEntity{
+			"City": testProperty("City", "Paris", true),
+			"Zip":  testProperty("Zip", int64(75000), false),
+		}, false),
+		"Tags":    testProperty("Tags", []interface{}{"a", "b"}, true),
+		"None":    testProperty("None", []interface{}{}, true),
+		"Deleted": testProperty("Deleted", nil, true),
+		"Notes":   testProperty("Notes", "long text", false),
+	}
+	for name, p := range want {
+		if !reflect.DeepEqual(entity[name], p) {
+			t.Errorf("%s = %#v, want %#v", name, entity[name], p)
+		}
+	}
+	if len(entity) != len(want) {
+		t.Errorf("decoded %d properties, want %d", len(entity), len(want))
+	}
+}
+
+func TestDecodeEntityProtoErrors(t *testing.T) {
+	truncated := protoBytes(nil, entityKey, []byte("reference"))
+	truncated = truncated[:len(truncated)-3]
+	badValue := protoProperty(nil, true, "Broken", 0, false, []byte{0xff})
+
+	for name, b := range map[string][]byte{"truncated field": truncated, "bad property value": badValue} {
+		if _, _, err := decodeEntityProto(b); err == nil {
+			t.Errorf("%s: decodeEntityProto succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// GetEntity retrieves a single entity by key from Datastore
+func GetEntity(ctx context.Context, client *datastore.Client, key *datastore.Key) (GeneralEntity, error) {
+	entity := GeneralEntity{}
+	if err := client.Get(ctx, key, &entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// PutEntity writes an entity to Datastore and returns its (possibly newly allocated) key
+func PutEntity(ctx context.Context, client *datastore.Client, key *datastore.Key, entity GeneralEntity) (*datastore.Key, error) {
+	return client.Put(ctx, key, &entity)
+}
+
+// deleteBatchSize is the largest number of keys Datastore accepts in one commit
+const deleteBatchSize = 500
+
+// DeleteEntities deletes the given keys in batches and returns how many of them
+// had an entity, keys already gone are not counted
+func DeleteEntities(ctx context.Context, client *datastore.Client, keys []*datastore.Key) (int, error) {
+	deleted := 0
+	for start := 0; start < len(keys); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(keys))
+		existing, err := countExisting(ctx, client, keys[start:end])
+		if err != nil {
+			return deleted, err
+		}
+		if err := client.DeleteMulti(ctx, keys[start:end]); err != nil {
+			return deleted, err
+		}
+		deleted += existing
+	}
+	return deleted, nil
+}
+
+// countExisting is how many of keys have an entity
+func countExisting(ctx context.Context, client *datastore.Client, keys []*datastore.Key) (int, error) {
+	err := client.GetMulti(ctx, keys, make([]datastore.PropertyList, len(keys)))
+	if err == nil {
+		return len(keys), nil
+	}
+	errs, ok := err.(datastore.MultiError)
+	if !ok {
+		return 0, err
+	}
+	existing := 0
+	for _, err := range errs {
+		switch err {
+		case nil:
+			existing++
+		case datastore.ErrNoSuchEntity:
+		default:
+			return 0, err
+		}
+	}
+	return existing, nil
+}
+
+// deleteKeys deletes keys known to exist in batches and returns how many were deleted
+func deleteKeys(ctx context.Context, client *datastore.Client, keys []*datastore.Key) (int, error) {
+	deleted := 0
+	for start := 0; start < len(keys); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(keys))
+		if err := client.DeleteMulti(ctx, keys[start:end]); err != nil {
+			return deleted, err
+		}
+		deleted += end - start
+	}
+	return deleted, nil
+}
+
+// DeleteAllEntities pages through a keys-only query of a kind and deletes every page
+func DeleteAllEntities(ctx context.Context, client *datastore.Client, namespace string, kind string) (int, error) {
+	deleted := 0
+	query := datastore.NewQuery(kind).Namespace(namespace).KeysOnly().Limit(deleteBatchSize)
+	for {
+		var keys []*datastore.Key
+		it := client.Run(ctx, query)
+		for {
+			key, err := it.Next(nil)
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return deleted, err
+			}
+			keys = append(keys, key)
+		}
+		if len(keys) == 0 {
+			return deleted, nil
+		}
+
+		// The query just returned the keys, they exist
+		n, err := deleteKeys(ctx, client, keys)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) < deleteBatchSize {
+			return deleted, nil
+		}
+
+		cursor, err := it.Cursor()
+		if err != nil {
+			return deleted, err
+		}
+		query = query.Start(cursor)
+	}
+}
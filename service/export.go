@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Export formats. JSON Lines keeps every type and can be imported again, NDJSON
+// has plain values for tools like jq, CSV has one column per table header.
+const (
+	FormatJSONLines = "jsonl"
+	FormatNDJSON    = "ndjson"
+	FormatCSV       = "csv"
+)
+
+var ExportFormats = []string{FormatJSONLines, FormatNDJSON, FormatCSV}
+
+// exportPageSize is how many entities are fetched per query while exporting
+const exportPageSize = 500
+
+// EachEntity calls fn for every result of query. Like a GQL query it skips
+// offset results first and stops after limit results, unless limit is 0.
+func EachEntity(ctx context.Context, client *datastore.Client, query *datastore.Query, offset int, limit int, fn func(GeneralEntity) error) (int, error) {
+	count := 0
+	cursor := ""
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	for {
+		pageSize := exportPageSize
+		if limit > 0 {
+			pageSize = min(pageSize, limit-count)
+		}
+		if pageSize == 0 {
+			return count, nil
+		}
+
+		entities, next, err := RunQuery(ctx, client, query, pageSize, cursor)
+		if err != nil {
+			return count, err
+		}
+		for _, e := range entities {
+			if err := fn(e); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if next == "" {
+			return count, nil
+		}
+		// The offset is already behind the cursor
+		cursor = next
+		query = query.Offset(0)
+	}
+}
+
+// Export writes every result of query to w and returns how many entities were written
+func Export(ctx context.Context, client *datastore.Client, query *datastore.Query, offset int, limit int, format string, w io.Writer) (int, error) {
+	switch format {
+	case FormatJSONLines, FormatNDJSON:
+		enc := json.NewEncoder(w)
+		return EachEntity(ctx, client, query, offset, limit, func(e GeneralEntity) error {
+			if format == FormatNDJSON {
+				return enc.Encode(PlainValue(e))
+			}
+			return enc.Encode(e)
+		})
+	case FormatCSV:
+		return exportCSV(ctx, client, query, offset, limit, w)
+	default:
+		return 0, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// exportCSV reads the results twice, first to find every column and then to
+// write the rows. Scalars use their text form, nested values are JSON.
+func exportCSV(ctx context.Context, client *datastore.Client, query *datastore.Query, offset int, limit int, w io.Writer) (int, error) {
+	columns := GeneralEntity{}
+	_, err := EachEntity(ctx, client, query, offset, limit, func(e GeneralEntity) error {
+		for name, p := range e {
+			if _, ok := columns[name]; !ok {
+				columns[name] = p
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	headers := GetTableHeaders([]GeneralEntity{columns})
+
+	cw := csv.NewWriter(w)
+	row := make([]string, len(headers))
+	for i, h := range headers {
+		row[i] = h.Name
+	}
+	if err := cw.Write(row); err != nil {
+		return 0, err
+	}
+	count, err := EachEntity(ctx, client, query, offset, limit, func(e GeneralEntity) error {
+		for i, h := range headers {
+			cell, err := csvCell(e, h.Name)
+			if err != nil {
+				return err
+			}
+			row[i] = cell
+		}
+		return cw.Write(row)
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	return count, err
+}
+
+func csvCell(e GeneralEntity, name string) (string, error) {
+	p, ok := e[name]
+	if !ok {
+		return "", nil
+	}
+	switch p.Value.(type) {
+	case GeneralEntity, []interface{}, *datastore.Entity:
+		b, err := json.Marshal(PlainValue(p.Value))
+		return string(b), err
+	default:
+		return FormatPropertyValue(p.Value), nil
+	}
+}
+
+// PlainValue converts a value to plain JSON values without type information:
+// entities become objects of values, keys are encoded and times are RFC 3339
+func PlainValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case GeneralEntity:
+		m := make(map[string]interface{}, len(v))
+		for name, p := range v {
+			m[name] = PlainValue(p.Value)
+		}
+		return m
+	case *datastore.Entity:
+		if v == nil {
+			return nil
+		}
+		nested := GeneralEntity{}
+		nested.Load(v.Properties)
+		return PlainValue(nested)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = PlainValue(item)
+		}
+		return items
+	case *datastore.Key:
+		if v == nil {
+			return nil
+		}
+		return v.Encode()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case datastore.GeoPoint:
+		return jsonGeoPoint{Lat: v.Lat, Lng: v.Lng}
+	default:
+		return v
+	}
+}
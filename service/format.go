@@ -0,0 +1,39 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// blobPreviewBytes is how many leading bytes of a blob are previewed
+const blobPreviewBytes = 16
+
+// FormatTime shows t in loc with its zone abbreviation
+func FormatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02 15:04:05.000 MST")
+}
+
+// MapURL opens p on a map
+func MapURL(p datastore.GeoPoint) string {
+	return fmt.Sprintf("https://www.google.com/maps/search/?api=1&query=%f,%f", p.Lat, p.Lng)
+}
+
+// HexPreview is the first bytes of b in hex, cut short with an ellipsis
+func HexPreview(b []byte) string {
+	if len(b) > blobPreviewBytes {
+		return hex.EncodeToString(b[:blobPreviewBytes]) + "…"
+	}
+	return hex.EncodeToString(b)
+}
+
+// Base64Preview is the first bytes of b in base64, cut short with an ellipsis
+func Base64Preview(b []byte) string {
+	if len(b) > blobPreviewBytes {
+		return base64.StdEncoding.EncodeToString(b[:blobPreviewBytes]) + "…"
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
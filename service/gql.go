@@ -0,0 +1,688 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"cloud.google.com/go/datastore"
+)
+
+// GQLQuery is a parsed GQL statement
+type GQLQuery struct {
+	Query    *datastore.Query // without limit and offset
+	Kind     string
+	KeysOnly bool
+	Limit    int // 0 when the statement has no LIMIT
+	Offset   int
+}
+
+// ParseGQL parses a GQL statement into a Datastore query. Keys without an explicit
+// NAMESPACE use namespace, and @name / @1 parameters are looked up in bindings.
+//
+// Supported: SELECT [DISTINCT [ON (...)]] * | __key__ | properties [FROM kind]
+// [WHERE cond [AND cond]...] [ORDER BY property [ASC|DESC], ...] [LIMIT n] [OFFSET n]
+func ParseGQL(gql string, namespace string, bindings map[string]interface{}) (*GQLQuery, error) {
+	tokens, err := lexGQL(gql)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{tokens: tokens, namespace: namespace, bindings: bindings}
+	return p.parseQuery()
+}
+
+// ParseGQLBindings parses one binding per line in the form "name = literal" or
+// "1 = literal", where literal uses GQL syntax (e.g. 'text', 42, KEY(Kind, 'a')).
+func ParseGQLBindings(text string, namespace string) (map[string]interface{}, error) {
+	bindings := map[string]interface{}{}
+	for n, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, literal, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("binding line %d: expected name = value", n+1)
+		}
+		name = strings.TrimPrefix(strings.TrimSpace(name), "@")
+		if name == "" {
+			return nil, fmt.Errorf("binding line %d: missing name", n+1)
+		}
+
+		tokens, err := lexGQL(literal)
+		if err != nil {
+			return nil, fmt.Errorf("binding @%s: %s", name, err)
+		}
+		p := &gqlParser{tokens: tokens, namespace: namespace}
+		value, err := p.parseValue()
+		if err == nil && !p.at(gqlEOF) {
+			err = p.unexpected()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("binding @%s: %s", name, err)
+		}
+		bindings[name] = value
+	}
+	return bindings, nil
+}
+
+type gqlTokenType int
+
+const (
+	gqlEOF gqlTokenType = iota
+	gqlIdent
+	gqlQuotedIdent
+	gqlString
+	gqlInt
+	gqlFloat
+	gqlBinding
+	gqlSymbol
+)
+
+type gqlToken struct {
+	typ gqlTokenType
+	val string
+	pos int
+}
+
+func (t gqlToken) String() string {
+	switch t.typ {
+	case gqlEOF:
+		return "end of statement"
+	case gqlString:
+		return strconv.Quote(t.val)
+	case gqlQuotedIdent:
+		return "`" + t.val + "`"
+	case gqlBinding:
+		return "@" + t.val
+	default:
+		return "'" + t.val + "'"
+	}
+}
+
+func lexGQL(s string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		r, size := utf8.DecodeRuneInString(s[i:])
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case c == '\'' || c == '"':
+			val, n, err := lexGQLString(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("GQL: %s at offset %d", err, start)
+			}
+			tokens = append(tokens, gqlToken{gqlString, val, start})
+			i += n
+		case c == '`':
+			end := strings.IndexByte(s[i+1:], '`')
+			if end < 0 {
+				return nil, fmt.Errorf("GQL: unterminated quoted name at offset %d", start)
+			}
+			tokens = append(tokens, gqlToken{gqlQuotedIdent, s[i+1 : i+1+end], start})
+			i += end + 2
+		case c == '@':
+			i++
+			i += gqlNameLength(s[i:])
+			if i == start+1 {
+				return nil, fmt.Errorf("GQL: missing parameter name at offset %d", start)
+			}
+			tokens = append(tokens, gqlToken{gqlBinding, s[start+1 : i], start})
+		case isGQLDigit(c) || (c == '-' || c == '+' || c == '.') && i+1 < len(s) && isGQLDigit(s[i+1]):
+			i++
+			typ := gqlInt
+			for i < len(s) && (isGQLDigit(s[i]) || s[i] == '.' || s[i] == 'e' || s[i] == 'E' ||
+				(s[i] == '-' || s[i] == '+') && (s[i-1] == 'e' || s[i-1] == 'E')) {
+				if !isGQLDigit(s[i]) {
+					typ = gqlFloat
+				}
+				i++
+			}
+			if c == '.' {
+				typ = gqlFloat
+			}
+			tokens = append(tokens, gqlToken{typ, s[start:i], start})
+		case isGQLNameRune(r):
+			i += gqlNameLength(s[i:])
+			tokens = append(tokens, gqlToken{gqlIdent, s[start:i], start})
+		case strings.HasPrefix(s[i:], "<=") || strings.HasPrefix(s[i:], ">=") || strings.HasPrefix(s[i:], "!="):
+			tokens = append(tokens, gqlToken{gqlSymbol, s[i : i+2], start})
+			i += 2
+		case strings.ContainsRune("*,()=<>.+", rune(c)):
+			tokens = append(tokens, gqlToken{gqlSymbol, string(c), start})
+			i++
+		default:
+			return nil, fmt.Errorf("GQL: unexpected character %q at offset %d", r, start)
+		}
+	}
+	return append(tokens, gqlToken{gqlEOF, "", len(s)}), nil
+}
+
+func lexGQLString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && i+1 < len(s) && s[i+1] == quote:
+			b.WriteByte(quote)
+			i++
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func isGQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isGQLNameRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsDigit(r) || unicode.IsLetter(r)
+}
+
+// gqlNameLength is the length in bytes of the name s starts with
+func gqlNameLength(s string) int {
+	n := 0
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !isGQLNameRune(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+type gqlParser struct {
+	tokens    []gqlToken
+	pos       int
+	namespace string
+	bindings  map[string]interface{}
+}
+
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.pos]
+	if t.typ != gqlEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *gqlParser) at(typ gqlTokenType) bool {
+	return p.peek().typ == typ
+}
+
+// keyword reports whether the next tokens are the given keywords, and consumes them if so
+func (p *gqlParser) keyword(words ...string) bool {
+	for i, w := range words {
+		if p.pos+i >= len(p.tokens) {
+			return false
+		}
+		t := p.tokens[p.pos+i]
+		if t.typ != gqlIdent || !strings.EqualFold(t.val, w) {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+func (p *gqlParser) symbol(s string) bool {
+	if t := p.peek(); t.typ == gqlSymbol && t.val == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) expectKeyword(w string) error {
+	if !p.keyword(w) {
+		return fmt.Errorf("GQL: expected %s but found %s at offset %d", w, p.peek(), p.peek().pos)
+	}
+	return nil
+}
+
+func (p *gqlParser) expectSymbol(s string) error {
+	if !p.symbol(s) {
+		return fmt.Errorf("GQL: expected '%s' but found %s at offset %d", s, p.peek(), p.peek().pos)
+	}
+	return nil
+}
+
+func (p *gqlParser) unexpected() error {
+	t := p.peek()
+	return fmt.Errorf("GQL: unexpected %s at offset %d", t, t.pos)
+}
+
+func (p *gqlParser) unsupported(clause string) error {
+	return fmt.Errorf("GQL: %s is not supported (offset %d)", clause, p.peek().pos)
+}
+
+var gqlReserved = map[string]bool{
+	"SELECT": true, "DISTINCT": true, "ON": true, "FROM": true, "WHERE": true, "AND": true, "OR": true,
+	"ORDER": true, "BY": true, "ASC": true, "DESC": true, "LIMIT": true, "OFFSET": true, "IS": true,
+	"NULL": true, "IN": true, "NOT": true, "HAS": true, "ANCESTOR": true, "DESCENDANT": true,
+	"TRUE": true, "FALSE": true, "CONTAINS": true,
+}
+
+// name parses a property or kind name, dotted names refer to nested properties
+func (p *gqlParser) name() (string, error) {
+	var parts []string
+	for {
+		t := p.peek()
+		switch {
+		case t.typ == gqlQuotedIdent:
+		case t.typ == gqlIdent && !gqlReserved[strings.ToUpper(t.val)]:
+		default:
+			return "", fmt.Errorf("GQL: expected a name but found %s at offset %d", t, t.pos)
+		}
+		parts = append(parts, p.next().val)
+		if !p.symbol(".") {
+			return strings.Join(parts, "."), nil
+		}
+	}
+}
+
+func (p *gqlParser) parseQuery() (*GQLQuery, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	q := &GQLQuery{}
+
+	distinct := false
+	var distinctOn, projection []string
+	if p.keyword("DISTINCT", "ON") {
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		names, err := p.nameList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		distinctOn = names
+	} else if p.keyword("DISTINCT") {
+		distinct = true
+	}
+
+	switch {
+	case p.symbol("*"):
+	case p.keyword("__key__"):
+		q.KeysOnly = true
+	default:
+		names, err := p.nameList()
+		if err != nil {
+			return nil, err
+		}
+		projection = names
+	}
+
+	if p.keyword("FROM") {
+		kind, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		q.Kind = kind
+	}
+
+	query := datastore.NewQuery(q.Kind).Namespace(p.namespace)
+	if q.KeysOnly {
+		query = query.KeysOnly()
+	}
+	if len(projection) > 0 {
+		query = query.Project(projection...)
+	}
+	if distinct {
+		if len(projection) == 0 {
+			return nil, fmt.Errorf("GQL: DISTINCT requires a list of projected properties")
+		}
+		query = query.Distinct()
+	}
+	if len(distinctOn) > 0 {
+		query = query.DistinctOn(distinctOn...)
+	}
+
+	if p.keyword("WHERE") {
+		for {
+			var err error
+			if query, err = p.condition(query); err != nil {
+				return nil, err
+			}
+			if p.keyword("OR") {
+				return nil, fmt.Errorf("GQL: OR is not supported, only AND (offset %d)", p.tokens[p.pos-1].pos)
+			}
+			if !p.keyword("AND") {
+				break
+			}
+		}
+	}
+
+	if p.keyword("ORDER", "BY") {
+		for {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if p.keyword("DESC") {
+				name = "-" + strconv.Quote(name)
+			} else {
+				p.keyword("ASC")
+				name = strconv.Quote(name)
+			}
+			query = query.Order(name)
+			if !p.symbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.keyword("LIMIT") {
+		n, err := p.resultPosition("LIMIT")
+		if err != nil {
+			return nil, err
+		}
+		q.Limit = n
+	}
+	if p.keyword("OFFSET") {
+		n, err := p.resultPosition("OFFSET")
+		if err != nil {
+			return nil, err
+		}
+		q.Offset = n
+	}
+
+	switch {
+	case p.keyword("GROUP"):
+		return nil, p.unsupported("GROUP BY")
+	case !p.at(gqlEOF):
+		return nil, p.unexpected()
+	}
+
+	q.Query = query
+	return q, nil
+}
+
+func (p *gqlParser) nameList() ([]string, error) {
+	var names []string
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.symbol(",") {
+			return names, nil
+		}
+	}
+}
+
+func (p *gqlParser) resultPosition(clause string) (int, error) {
+	if p.keyword("FIRST") {
+		return 0, p.unsupported(clause + " FIRST(...)")
+	}
+	t := p.peek()
+	value, err := p.parseValue()
+	if err != nil {
+		return 0, err
+	}
+	n, ok := value.(int64)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("GQL: %s expects a non-negative integer at offset %d", clause, t.pos)
+	}
+	if p.symbol("+") {
+		return 0, p.unsupported(clause + " with a cursor")
+	}
+	return int(n), nil
+}
+
+var gqlOperators = map[string]string{"=": "=", "<": "<", "<=": "<=", ">": ">", ">=": ">=", "!=": "!="}
+
+func (p *gqlParser) condition(query *datastore.Query) (*datastore.Query, error) {
+	if p.at(gqlString) || p.at(gqlInt) || p.at(gqlFloat) || p.at(gqlBinding) {
+		return nil, p.unsupported("a value on the left side of a condition")
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	field := strconv.Quote(name)
+
+	switch {
+	case p.keyword("IS", "NULL"):
+		return query.FilterField(field, "=", nil), nil
+	case p.keyword("HAS", "ANCESTOR"):
+		if name != "__key__" {
+			return nil, fmt.Errorf("GQL: HAS ANCESTOR is only valid on __key__")
+		}
+		t := p.peek()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := value.(*datastore.Key)
+		if !ok {
+			return nil, fmt.Errorf("GQL: HAS ANCESTOR expects a key at offset %d", t.pos)
+		}
+		return query.Ancestor(key), nil
+	case p.keyword("HAS", "DESCENDANT"):
+		return nil, p.unsupported("HAS DESCENDANT")
+	case p.keyword("CONTAINS"):
+		return nil, p.unsupported("CONTAINS")
+	case p.keyword("NOT", "IN"):
+		return p.inCondition(query, field, "not-in", "NOT IN")
+	case p.keyword("IN"):
+		return p.inCondition(query, field, "in", "IN")
+	}
+
+	t := p.next()
+	op, ok := gqlOperators[t.val]
+	if t.typ != gqlSymbol || !ok {
+		return nil, fmt.Errorf("GQL: expected a comparison operator but found %s at offset %d", t, t.pos)
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return query.FilterField(field, op, value), nil
+}
+
+func (p *gqlParser) inCondition(query *datastore.Query, field string, op string, clause string) (*datastore.Query, error) {
+	t := p.peek()
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := value.([]interface{}); !ok {
+		return nil, fmt.Errorf("GQL: %s expects ARRAY(...) at offset %d", clause, t.pos)
+	}
+	return query.FilterField(field, op, value), nil
+}
+
+func (p *gqlParser) parseValue() (interface{}, error) {
+	t := p.next()
+	switch t.typ {
+	case gqlString:
+		return t.val, nil
+	case gqlInt:
+		n, err := strconv.ParseInt(t.val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("GQL: invalid integer %s at offset %d", t.val, t.pos)
+		}
+		return n, nil
+	case gqlFloat:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("GQL: invalid number %s at offset %d", t.val, t.pos)
+		}
+		return f, nil
+	case gqlBinding:
+		value, ok := p.bindings[t.val]
+		if !ok {
+			return nil, fmt.Errorf("GQL: unbound parameter @%s at offset %d", t.val, t.pos)
+		}
+		return value, nil
+	case gqlIdent:
+		switch strings.ToUpper(t.val) {
+		case "TRUE":
+			return true, nil
+		case "FALSE":
+			return false, nil
+		case "NULL":
+			return nil, nil
+		case "KEY":
+			return p.parseKey()
+		case "ARRAY":
+			return p.parseArray()
+		case "DATETIME":
+			s, err := p.parseStringCall(t)
+			if err != nil {
+				return nil, err
+			}
+			v, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, fmt.Errorf("GQL: invalid DATETIME %q at offset %d, expected RFC 3339", s, t.pos)
+			}
+			return v, nil
+		case "BLOB":
+			s, err := p.parseStringCall(t)
+			if err != nil {
+				return nil, err
+			}
+			v, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("GQL: invalid base64 BLOB at offset %d", t.pos)
+			}
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("GQL: expected a value but found %s at offset %d", t, t.pos)
+}
+
+func (p *gqlParser) parseStringCall(fn gqlToken) (string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return "", err
+	}
+	t := p.next()
+	if t.typ != gqlString {
+		return "", fmt.Errorf("GQL: %s expects a string but found %s at offset %d", strings.ToUpper(fn.val), t, t.pos)
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return "", err
+	}
+	return t.val, nil
+}
+
+func (p *gqlParser) parseArray() ([]interface{}, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	values := []interface{}{}
+	if p.symbol(")") {
+		return values, nil
+	}
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if p.symbol(")") {
+			return values, nil
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseKey parses KEY([PROJECT('p'),] [NAMESPACE('ns'),] kind, id_or_name, ...)
+func (p *gqlParser) parseKey() (*datastore.Key, error) {
+	start := p.tokens[p.pos-1]
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	namespace := p.namespace
+	if p.keyword("PROJECT") {
+		if _, err := p.parseStringCall(p.tokens[p.pos-1]); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("NAMESPACE") {
+		ns, err := p.parseStringCall(p.tokens[p.pos-1])
+		if err != nil {
+			return nil, err
+		}
+		namespace = ns
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+
+	var key *datastore.Key
+	for {
+		t := p.next()
+		if t.typ != gqlIdent && t.typ != gqlQuotedIdent && t.typ != gqlString {
+			return nil, fmt.Errorf("GQL: expected a kind in KEY but found %s at offset %d", t, t.pos)
+		}
+		kind := t.val
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+		id := p.next()
+		switch id.typ {
+		case gqlInt:
+			n, err := strconv.ParseInt(id.val, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("GQL: invalid key ID %s at offset %d", id.val, id.pos)
+			}
+			key = datastore.IDKey(kind, n, key)
+		case gqlString:
+			key = datastore.NameKey(kind, id.val, key)
+		default:
+			return nil, fmt.Errorf("GQL: expected a key ID or name but found %s at offset %d", id, id.pos)
+		}
+		key.Namespace = namespace
+		if p.symbol(")") {
+			break
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("GQL: empty KEY at offset %d", start.pos)
+	}
+	return key, nil
+}
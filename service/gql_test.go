@@ -0,0 +1,239 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+func TestParseGQL(t *testing.T) {
+	user := datastore.NameKey("User", "alice", nil)
+	user.Namespace = "ns"
+	order := datastore.IDKey("Purchase", 7, user)
+	order.Namespace = "ns"
+	other := datastore.NameKey("User", "bob", nil)
+	other.Namespace = "other"
+	created := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	query := func(kind string) *datastore.Query {
+		return datastore.NewQuery(kind).Namespace("ns")
+	}
+	tests := []struct {
+		name     string
+		gql      string
+		bindings map[string]interface{}
+		want     *GQLQuery
+	}{
+		{
+			name: "select all",
+			gql:  "SELECT * FROM User",
+			want: &GQLQuery{Kind: "User", Query: query("User")},
+		},
+		{
+			name: "keywords in any case",
+			gql:  "select * from User where Age = 3",
+			want: &GQLQuery{Kind: "User", Query: query("User").FilterField(`"Age"`, "=", int64(3))},
+		},
+		{
+			name: "keys only",
+			gql:  "SELECT __key__ FROM User",
+			want: &GQLQuery{Kind: "User", KeysOnly: true, Query: query("User").KeysOnly()},
+		},
+		{
+			name: "projection",
+			gql:  "SELECT Name, Address.City FROM User",
+			want: &GQLQuery{Kind: "User", Query: query("User").Project("Name", "Address.City")},
+		},
+		{
+			name: "distinct projection",
+			gql:  "SELECT DISTINCT Name FROM User",
+			want: &GQLQuery{Kind: "User", Query: query("User").Project("Name").Distinct()},
+		},
+		{
+			name: "distinct on",
+			gql:  "SELECT DISTINCT ON (Name) Name, Age FROM User",
+			want: &GQLQuery{Kind: "User", Query: query("User").Project("Name", "Age").DistinctOn("Name")},
+		},
+		{
+			name: "quoted names",
+			gql:  "SELECT * FROM `User Profile` WHERE `first name` = 'Ann'",
+			want: &GQLQuery{Kind: "User Profile", Query: query("User Profile").FilterField(`"first name"`, "=", "Ann")},
+		},
+		{
+			name: "unicode names",
+			gql:  "SELECT * FROM Café WHERE größe > 2.5",
+			want: &GQLQuery{Kind: "Café", Query: query("Café").FilterField(`"größe"`, ">", 2.5)},
+		},
+		{
+			name: "is null",
+			gql:  "SELECT * FROM User WHERE Email IS NULL",
+			want: &GQLQuery{Kind: "User", Query: query("User").FilterField(`"Email"`, "=", nil)},
+		},
+		{
+			name: "has ancestor",
+			gql:  "SELECT * FROM Purchase WHERE __key__ HAS ANCESTOR KEY(User, 'alice')",
+			want: &GQLQuery{Kind: "Purchase", Query: query("Purchase").Ancestor(user)},
+		},
+		{
+			name: "in and not in",
+			gql:  "SELECT * FROM User WHERE Role IN ARRAY('admin', 'owner') AND Age NOT IN ARRAY(1, 2)",
+			want: &GQLQuery{Kind: "User", Query: query("User").
+				FilterField(`"Role"`, "in", []interface{}{"admin", "owner"}).
+				FilterField(`"Age"`, "not-in", []interface{}{int64(1), int64(2)})},
+		},
+		{
+			name: "comparisons",
+			gql:  "SELECT * FROM User WHERE Age >= 18 AND Age != 30 AND Active = true AND Score < -1.5",
+			want: &GQLQuery{Kind: "User", Query: query("User").
+				FilterField(`"Age"`, ">=", int64(18)).
+				FilterField(`"Age"`, "!=", int64(30)).
+				FilterField(`"Active"`, "=", true).
+				FilterField(`"Score"`, "<", -1.5)},
+		},
+		{
+			name: "order limit offset",
+			gql:  "SELECT * FROM User ORDER BY Age DESC, Name ASC, Created LIMIT 10 OFFSET 20",
+			want: &GQLQuery{Kind: "User", Limit: 10, Offset: 20, Query: query("User").
+				Order(`-"Age"`).Order(`"Name"`).Order(`"Created"`)},
+		},
+		{
+			name: "nested key",
+			gql:  "SELECT * FROM Item WHERE `Order` = KEY(User, 'alice', Purchase, 7)",
+			want: &GQLQuery{Kind: "Item", Query: query("Item").FilterField(`"Order"`, "=", order)},
+		},
+		{
+			name: "key with project and namespace",
+			gql:  "SELECT * FROM User WHERE __key__ = KEY(PROJECT('p'), NAMESPACE('other'), User, 'bob')",
+			want: &GQLQuery{Kind: "User", Query: query("User").FilterField(`"__key__"`, "=", other)},
+		},
+		{
+			name: "datetime",
+			gql:  "SELECT * FROM User WHERE Created > DATETIME('2024-05-01T12:30:00Z')",
+			want: &GQLQuery{Kind: "User", Query: query("User").FilterField(`"Created"`, ">", created)},
+		},
+		{
+			name: "blob",
+			gql:  "SELECT * FROM User WHERE Avatar = BLOB('AQID')",
+			want: &GQLQuery{Kind: "User", Query: query("User").FilterField(`"Avatar"`, "=", []byte{1, 2, 3})},
+		},
+		{
+			name: "escaped strings",
+			gql:  `SELECT * FROM User WHERE Name = 'it''s' AND Note = "a\nb"`,
+			want: &GQLQuery{Kind: "User", Query: query("User").
+				FilterField(`"Name"`, "=", "it's").
+				FilterField(`"Note"`, "=", "a\nb")},
+		},
+		{
+			name:     "named and positional bindings",
+			gql:      "SELECT * FROM User WHERE Name = @name AND Age > @1 LIMIT @limit",
+			bindings: map[string]interface{}{"name": "Ann", "1": int64(3), "limit": int64(5)},
+			want: &GQLQuery{Kind: "User", Limit: 5, Query: query("User").
+				FilterField(`"Name"`, "=", "Ann").
+				FilterField(`"Age"`, ">", int64(3))},
+		},
+		{
+			name: "kindless",
+			gql:  "SELECT __key__ WHERE __key__ HAS ANCESTOR KEY(User, 'alice')",
+			want: &GQLQuery{KeysOnly: true, Query: query("").KeysOnly().Ancestor(user)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGQL(tt.gql, "ns", tt.bindings)
+			if err != nil {
+				t.Fatalf("ParseGQL(%q): %v", tt.gql, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseGQL(%q) = %+v, want %+v", tt.gql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGQLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		gql  string
+		want string
+	}{
+		{"empty", "", "expected SELECT"},
+		{"not a select", "DELETE FROM User", "expected SELECT"},
+		{"or", "SELECT * FROM User WHERE A = 1 OR B = 2", "OR is not supported"},
+		{"group by", "SELECT * FROM User GROUP BY Name", "GROUP BY is not supported"},
+		{"contains", "SELECT * FROM User WHERE Tags CONTAINS 'a'", "CONTAINS is not supported"},
+		{"has descendant", "SELECT * FROM User WHERE __key__ HAS DESCENDANT KEY(User, 'a')", "HAS DESCENDANT is not supported"},
+		{"value on the left", "SELECT * FROM User WHERE 3 = Age", "value on the left side"},
+		{"limit first", "SELECT * FROM User LIMIT FIRST(1, 2)", "LIMIT FIRST(...) is not supported"},
+		{"limit cursor", "SELECT * FROM User LIMIT 1 + 2", "LIMIT with a cursor is not supported"},
+		{"negative limit", "SELECT * FROM User LIMIT -1", "non-negative integer"},
+		{"distinct without projection", "SELECT DISTINCT * FROM User", "DISTINCT requires"},
+		{"ancestor on a property", "SELECT * FROM User WHERE Parent HAS ANCESTOR KEY(User, 'a')", "only valid on __key__"},
+		{"ancestor not a key", "SELECT * FROM User WHERE __key__ HAS ANCESTOR 'a'", "expects a key"},
+		{"in without array", "SELECT * FROM User WHERE Age IN 3", "IN expects ARRAY"},
+		{"unbound parameter", "SELECT * FROM User WHERE Name = @name", "unbound parameter @name"},
+		{"missing parameter name", "SELECT * FROM User WHERE Name = @", "missing parameter name"},
+		{"unterminated string", "SELECT * FROM User WHERE Name = 'Ann", "unterminated string"},
+		{"unterminated quoted name", "SELECT * FROM `User", "unterminated quoted name"},
+		{"bad character", "SELECT * FROM User WHERE Name = ;", "unexpected character ';'"},
+		{"bad operator", "SELECT * FROM User WHERE Age => 3", "expected a value"},
+		{"missing operator", "SELECT * FROM User WHERE Age 3", "expected a comparison operator"},
+		{"reserved name", "SELECT * FROM Order", "expected a name but found 'Order'"},
+		{"trailing tokens", "SELECT * FROM User LIMIT 1 Extra", "unexpected 'Extra'"},
+		{"invalid datetime", "SELECT * FROM User WHERE Created = DATETIME('yesterday')", "invalid DATETIME"},
+		{"invalid blob", "SELECT * FROM User WHERE Avatar = BLOB('***')", "invalid base64 BLOB"},
+		{"key without id", "SELECT * FROM User WHERE __key__ = KEY(User)", "expected ','"},
+		{"key with float id", "SELECT * FROM User WHERE __key__ = KEY(User, 1.5)", "expected a key ID or name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseGQL(tt.gql, "ns", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseGQL(%q) error = %v, want it to contain %q", tt.gql, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGQLBindings(t *testing.T) {
+	key := datastore.IDKey("User", 5, nil)
+	key.Namespace = "ns"
+	text := `
+name = 'Ann'
+@1 = 42
+ratio = 0.5
+active = false
+missing = NULL
+tags = ARRAY('a', 'b')
+owner = KEY(User, 5)
+`
+	got, err := ParseGQLBindings(text, "ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name":    "Ann",
+		"1":       int64(42),
+		"ratio":   0.5,
+		"active":  false,
+		"missing": nil,
+		"tags":    []interface{}{"a", "b"},
+		"owner":   key,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseGQLBindings = %v, want %v", got, want)
+	}
+
+	for _, bad := range []struct{ text, want string }{
+		{"name", "line 1: expected name = value"},
+		{"\n = 1", "line 2: missing name"},
+		{"name = 1 2", "binding @name: GQL: unexpected '2'"},
+		{"name = Age", "binding @name: GQL: expected a value"},
+	} {
+		if _, err := ParseGQLBindings(bad.text, "ns"); err == nil || !strings.Contains(err.Error(), bad.want) {
+			t.Errorf("ParseGQLBindings(%q) error = %v, want it to contain %q", bad.text, err, bad.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Import formats, the files Export writes in these formats can be read back
+var ImportFormats = []string{FormatJSONLines, FormatCSV}
+
+// ImportRow is an entity read from line Line of an import file
+type ImportRow struct {
+	Line   int
+	Key    *datastore.Key
+	Entity GeneralEntity
+}
+
+// RowError is why line Line of an import file was not imported
+type RowError struct {
+	Line    int
+	Message string
+}
+
+// importBatchSize is the largest number of entities Datastore accepts in one commit
+const importBatchSize = 500
+
+// maxLineSize is the longest JSON Lines row that can be read
+const maxLineSize = 16 << 20
+
+// ReadImport reads every row of an import file. Rows without a key column get an
+// incomplete key of kind in namespace. CSV cells are parsed as the type columnTypes
+// gives their column, string by default, and empty cells are left out.
+func ReadImport(r io.Reader, format string, namespace string, kind string, columnTypes map[string]string) ([]ImportRow, []RowError, error) {
+	switch format {
+	case FormatJSONLines:
+		return readJSONLines(r, namespace, kind)
+	case FormatCSV:
+		return readCSV(r, namespace, kind, columnTypes)
+	default:
+		return nil, nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+func readJSONLines(r io.Reader, namespace string, kind string) ([]ImportRow, []RowError, error) {
+	var rows []ImportRow
+	var rowErrors []RowError
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entity GeneralEntity
+		if err := json.Unmarshal([]byte(text), &entity); err != nil {
+			rowErrors = append(rowErrors, RowError{Line: line, Message: err.Error()})
+			continue
+		}
+		row, err := importRow(line, entity, namespace, kind)
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Line: line, Message: err.Error()})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, scanner.Err()
+}
+
+func readCSV(r io.Reader, namespace string, kind string, columnTypes map[string]string) ([]ImportRow, []RowError, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("the CSV file is empty")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	for name := range columnTypes {
+		if !slices.Contains(header, name) {
+			return nil, nil, fmt.Errorf("column %s is not in the CSV header", name)
+		}
+	}
+
+	var rows []ImportRow
+	var rowErrors []RowError
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, rowErrors, nil
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Line: line, Message: err.Error()})
+			continue
+		}
+		entity, err := entityFromRecord(header, record, columnTypes)
+		if err == nil {
+			var row ImportRow
+			if row, err = importRow(line, entity, namespace, kind); err == nil {
+				rows = append(rows, row)
+				continue
+			}
+		}
+		rowErrors = append(rowErrors, RowError{Line: line, Message: err.Error()})
+	}
+}
+
+func entityFromRecord(header []string, record []string, columnTypes map[string]string) (GeneralEntity, error) {
+	entity := GeneralEntity{}
+	for i, name := range header {
+		if i >= len(record) || record[i] == "" {
+			continue
+		}
+		typeOf := TypeString
+		if name == "key" {
+			typeOf = TypeKey
+		}
+		if t, ok := columnTypes[name]; ok {
+			typeOf = t
+		}
+		value, err := ParsePropertyValue(typeOf, record[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		entity[name] = OutputProperty{Name: name, Value: value, TypeOf: typeOf, Indexed: typeOf != TypeBytes}
+	}
+	return entity, nil
+}
+
+// importRow takes the key out of the synthetic key column, or makes an incomplete one
+func importRow(line int, entity GeneralEntity, namespace string, kind string) (ImportRow, error) {
+	key := entity.Key()
+	delete(entity, "key")
+	if key == nil {
+		if kind == "" {
+			return ImportRow{}, fmt.Errorf("the row has no key and no kind was given")
+		}
+		key = datastore.IncompleteKey(kind, nil)
+		key.Namespace = namespace
+	}
+	return ImportRow{Line: line, Key: key, Entity: entity}, nil
+}
+
+// ParseColumnTypes reads one "column = type" per line, the types being ScalarTypes
+func ParseColumnTypes(text string) (map[string]string, error) {
+	types := map[string]string{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, typeOf, ok := strings.Cut(line, "=")
+		name, typeOf = strings.TrimSpace(name), strings.TrimSpace(typeOf)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: expected column = type", i+1)
+		}
+		if !slices.Contains(ScalarTypes, typeOf) {
+			return nil, fmt.Errorf("line %d: unsupported column type %q", i+1, typeOf)
+		}
+		types[name] = typeOf
+	}
+	return types, nil
+}
+
+// ImportEntities writes rows with PutMulti in batches. progress is called after
+// every batch with the number of rows done so far. Rows Datastore rejects are
+// returned as errors, the other rows of their batch are still written.
+func ImportEntities(ctx context.Context, client *datastore.Client, rows []ImportRow, progress func(done int)) (int, []RowError) {
+	written := 0
+	var rowErrors []RowError
+	for start := 0; start < len(rows); start += importBatchSize {
+		batch := rows[start:min(start+importBatchSize, len(rows))]
+		err := putRows(ctx, client, batch)
+
+		// A rejected entity fails the whole commit, retry without the rejected rows
+		var multiErr datastore.MultiError
+		if errors.As(err, &multiErr) && len(multiErr) == len(batch) {
+			var accepted []ImportRow
+			for i, err := range multiErr {
+				if err != nil {
+					rowErrors = append(rowErrors, RowError{Line: batch[i].Line, Message: err.Error()})
+				} else {
+					accepted = append(accepted, batch[i])
+				}
+			}
+			batch = accepted
+			err = putRows(ctx, client, batch)
+		}
+
+		if err != nil {
+			for _, row := range batch {
+				rowErrors = append(rowErrors, RowError{Line: row.Line, Message: err.Error()})
+			}
+		} else {
+			written += len(batch)
+		}
+		progress(min(start+importBatchSize, len(rows)))
+	}
+	return written, rowErrors
+}
+
+func putRows(ctx context.Context, client *datastore.Client, rows []ImportRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	keys := make([]*datastore.Key, len(rows))
+	entities := make([]GeneralEntity, len(rows))
+	for i, row := range rows {
+		keys[i] = row.Key
+		entities[i] = row.Entity
+	}
+	_, err := client.PutMulti(ctx, keys, entities)
+	return err
+}
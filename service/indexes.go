@@ -0,0 +1,208 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IndexProperty is one property of a composite index, Direction is "asc" or "desc"
+type IndexProperty struct {
+	Name      string `yaml:"name"`
+	Direction string `yaml:"direction,omitempty"`
+}
+
+// Index is a composite index as index.yaml declares it
+type Index struct {
+	Kind       string
+	Ancestor   bool
+	Properties []IndexProperty
+	equalities int // leading properties that only equality filters use, in any order
+}
+
+// indexFile is the layout of index.yaml, ancestor is yes or no there
+type indexFile struct {
+	Indexes []struct {
+		Kind       string          `yaml:"kind"`
+		Ancestor   string          `yaml:"ancestor"`
+		Properties []IndexProperty `yaml:"properties"`
+	} `yaml:"indexes"`
+}
+
+// LoadIndexes reads the composite indexes declared in an index.yaml
+func LoadIndexes(path string) ([]Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file indexFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("reading %s: %s", path, err)
+	}
+
+	indexes := make([]Index, len(file.Indexes))
+	for i, declared := range file.Indexes {
+		if declared.Kind == "" {
+			return nil, fmt.Errorf("reading %s: index %d has no kind", path, i+1)
+		}
+		idx := Index{Kind: declared.Kind, Properties: declared.Properties}
+		switch strings.ToLower(declared.Ancestor) {
+		case "", "no", "false":
+		case "yes", "true":
+			idx.Ancestor = true
+		default:
+			return nil, fmt.Errorf("reading %s: index %d of %s: ancestor must be yes or no", path, i+1, declared.Kind)
+		}
+		for j := range idx.Properties {
+			idx.Properties[j].Direction = indexDirection(idx.Properties[j].Direction)
+		}
+		indexes[i] = idx
+	}
+	return indexes, nil
+}
+
+func indexDirection(direction string) string {
+	if strings.HasPrefix(strings.ToLower(direction), "desc") {
+		return "desc"
+	}
+	return "asc"
+}
+
+func (idx Index) String() string {
+	properties := make([]string, len(idx.Properties))
+	for i, p := range idx.Properties {
+		properties[i] = Order{Property: p.Name, Direction: p.Direction}.String()
+	}
+	ancestor := ""
+	if idx.Ancestor {
+		ancestor = " with ancestor"
+	}
+	return fmt.Sprintf("%s%s (%s)", idx.Kind, ancestor, strings.Join(properties, ", "))
+}
+
+// inequalityOperators need the property to be the first sort order
+var inequalityOperators = []string{"<", "<=", ">", ">=", "!=", "NOT IN"}
+
+// RequiredIndex is the composite index q needs in production, false when the
+// built-in single property indexes serve it. Equality filters come first in
+// the index, then the sort orders, led by the inequality filter if any.
+func RequiredIndex(q EntityQuery) (Index, bool) {
+	var equalities []string
+	var orders []Order
+	for _, f := range q.Filters {
+		if f.Property == "key" {
+			continue
+		}
+		if slices.Contains(inequalityOperators, f.Operator) {
+			// The inequality property sorts first, ascending unless ordered otherwise
+			if !slices.ContainsFunc(orders, func(o Order) bool { return o.Property == f.Property }) {
+				orders = append(orders, Order{Property: f.Property, Direction: "asc"})
+			}
+		} else if !slices.Contains(equalities, f.Property) {
+			equalities = append(equalities, f.Property)
+		}
+	}
+	for _, o := range q.Orders {
+		// Sorting on an equality filtered property changes nothing
+		if slices.Contains(equalities, o.Property) {
+			continue
+		}
+		if i := slices.IndexFunc(orders, func(x Order) bool { return x.Property == o.Property }); i >= 0 {
+			orders[i].Direction = o.Direction
+			continue
+		}
+		orders = append(orders, o)
+	}
+	// Every index ends in the key ascending
+	if n := len(orders); n > 0 && orders[n-1].Property == "key" && orders[n-1].Direction != "desc" {
+		orders = orders[:n-1]
+	}
+
+	builtIn := len(orders) == 0 ||
+		len(orders) == 1 && len(equalities) == 0 && q.Ancestor == nil ||
+		len(orders) == 1 && orders[0].Property == "key" && len(equalities) == 0
+	if builtIn {
+		return Index{}, false
+	}
+
+	idx := Index{Kind: q.Kind, Ancestor: q.Ancestor != nil, equalities: len(equalities)}
+	for _, name := range equalities {
+		idx.Properties = append(idx.Properties, IndexProperty{Name: name, Direction: "asc"})
+	}
+	for _, o := range orders {
+		name := o.Property
+		if name == "key" {
+			name = "__key__"
+		}
+		idx.Properties = append(idx.Properties, IndexProperty{Name: name, Direction: indexDirection(o.Direction)})
+	}
+	return idx, true
+}
+
+// Serves tells whether idx can serve queries that need required: same kind and
+// ancestor, the equality properties in any order and direction, then the same orders
+func (idx Index) Serves(required Index) bool {
+	if idx.Kind != required.Kind || idx.Ancestor != required.Ancestor || len(idx.Properties) != len(required.Properties) {
+		return false
+	}
+	n := required.equalities
+	for _, p := range idx.Properties[:n] {
+		if !slices.ContainsFunc(required.Properties[:n], func(r IndexProperty) bool { return r.Name == p.Name }) {
+			return false
+		}
+	}
+	return slices.Equal(idx.Properties[n:], required.Properties[n:])
+}
+
+// MissingIndex is the composite index q needs that none of indexes serves
+func MissingIndex(q EntityQuery, indexes []Index) (Index, bool) {
+	required, ok := RequiredIndex(q)
+	if !ok {
+		return Index{}, false
+	}
+	for _, idx := range indexes {
+		if idx.Serves(required) {
+			return Index{}, false
+		}
+	}
+	return required, true
+}
+
+// IndexYAML declares indexes the way index.yaml does, ready to paste into it
+func IndexYAML(indexes []Index) string {
+	var b strings.Builder
+	b.WriteString("indexes:\n")
+	for _, idx := range indexes {
+		fmt.Fprintf(&b, "\n- kind: %s\n", idx.Kind)
+		if idx.Ancestor {
+			b.WriteString("  ancestor: yes\n")
+		}
+		b.WriteString("  properties:\n")
+		for _, p := range idx.Properties {
+			fmt.Fprintf(&b, "  - name: %s\n", yamlName(p.Name))
+			if p.Direction == "desc" {
+				b.WriteString("    direction: desc\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// yamlWords are read as booleans or null by the YAML 1.1 parsers gcloud uses
+var yamlWords = []string{"y", "n", "yes", "no", "on", "off", "true", "false", "null", "~"}
+
+// yamlName quotes property names YAML would not read back as the same string
+func yamlName(name string) string {
+	if slices.Contains(yamlWords, strings.ToLower(name)) {
+		return strconv.Quote(name)
+	}
+	var read map[string]interface{}
+	if err := yaml.Unmarshal([]byte("v: "+name), &read); err != nil || read["v"] != name {
+		return strconv.Quote(name)
+	}
+	return name
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+)
+
+func asc(name string) IndexProperty  { return IndexProperty{Name: name, Direction: "asc"} }
+func desc(name string) IndexProperty { return IndexProperty{Name: name, Direction: "desc"} }
+
+func TestRequiredIndex(t *testing.T) {
+	parent := datastore.NameKey("User", "alice", nil)
+	equal := func(property string) Filter {
+		return Filter{Property: property, Operator: "=", Value: "1", Type: TypeInt64}
+	}
+	above := func(property string) Filter {
+		return Filter{Property: property, Operator: ">", Value: "1", Type: TypeInt64}
+	}
+
+	tests := []struct {
+		name  string
+		query EntityQuery
+		want  *Index // nil when the built-in indexes serve the query
+	}{
+		{
+			name:  "no filters or orders",
+			query: EntityQuery{Kind: "User"},
+		},
+		{
+			name:  "one order",
+			query: EntityQuery{Kind: "User", Orders: []Order{{"Age", "desc"}}},
+		},
+		{
+			name:  "equality filters only",
+			query: EntityQuery{Kind: "User", Filters: []Filter{equal("Age"), equal("Active")}},
+		},
+		{
+			name:  "equality plus sort order",
+			query: EntityQuery{Kind: "User", Filters: []Filter{equal("Active")}, Orders: []Order{{"Age", "desc"}}},
+			want:  &Index{Kind: "User", Properties: []IndexProperty{asc("Active"), desc("Age")}, equalities: 1},
+		},
+		{
+			name:  "sort on the equality property",
+			query: EntityQuery{Kind: "User", Filters: []Filter{equal("Age")}, Orders: []Order{{"Age", "desc"}}},
+		},
+		{
+			name:  "two sort orders",
+			query: EntityQuery{Kind: "User", Orders: []Order{{"Name", "asc"}, {"Age", "desc"}}},
+			want:  &Index{Kind: "User", Properties: []IndexProperty{asc("Name"), desc("Age")}},
+		},
+		{
+			name:  "inequality alone",
+			query: EntityQuery{Kind: "User", Filters: []Filter{above("Age")}},
+		},
+		{
+			name:  "inequality sorted by its property",
+			query: EntityQuery{Kind: "User", Filters: []Filter{above("Age")}, Orders: []Order{{"Age", "desc"}}},
+		},
+		{
+			name:  "inequality forces the first sort order",
+			query: EntityQuery{Kind: "User", Filters: []Filter{above("Age")}, Orders: []Order{{"Name", "asc"}}},
+			want:  &Index{Kind: "User", Properties: []IndexProperty{asc("Age"), asc("Name")}},
+		},
+		{
+			name: "inequality direction from its order",
+			query: EntityQuery{Kind: "User", Filters: []Filter{equal("Active"), above("Age")},
+				Orders: []Order{{"Name", "desc"}, {"Age", "desc"}}},
+			want: &Index{Kind: "User", Properties: []IndexProperty{asc("Active"), desc("Age"), desc("Name")}, equalities: 1},
+		},
+		{
+			name:  "ancestor with a sort order",
+			query: EntityQuery{Kind: "User", Ancestor: parent, Orders: []Order{{"Name", "desc"}}},
+			want:  &Index{Kind: "User", Ancestor: true, Properties: []IndexProperty{desc("Name")}},
+		},
+		{
+			name:  "ancestor with an equality",
+			query: EntityQuery{Kind: "User", Ancestor: parent, Filters: []Filter{equal("Active")}},
+		},
+		{
+			name:  "ancestor sorted by key",
+			query: EntityQuery{Kind: "User", Ancestor: parent, Orders: []Order{{"key", "desc"}}},
+		},
+		{
+			name:  "trailing key ascending",
+			query: EntityQuery{Kind: "User", Orders: []Order{{"Name", "asc"}, {"key", "asc"}}},
+		},
+		{
+			name:  "trailing key descending",
+			query: EntityQuery{Kind: "User", Orders: []Order{{"Name", "asc"}, {"key", "desc"}}},
+			want:  &Index{Kind: "User", Properties: []IndexProperty{asc("Name"), desc("__key__")}},
+		},
+		{
+			name:  "key filters",
+			query: EntityQuery{Kind: "User", Filters: []Filter{{Property: "key", Operator: ">", Value: "a"}}, Orders: []Order{{"Name", "asc"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := RequiredIndex(tt.query)
+			switch {
+			case tt.want == nil && ok:
+				t.Errorf("RequiredIndex = %s, want none", got)
+			case tt.want != nil && !ok:
+				t.Errorf("RequiredIndex = none, want %s", tt.want)
+			case tt.want != nil && !reflect.DeepEqual(got, *tt.want):
+				t.Errorf("RequiredIndex = %#v, want %#v", got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexServes(t *testing.T) {
+	required := Index{Kind: "User", Properties: []IndexProperty{asc("Active"), asc("Role"), desc("Age")}, equalities: 2}
+	tests := []struct {
+		name     string
+		declared Index
+		want     bool
+	}{
+		{"same index", Index{Kind: "User", Properties: []IndexProperty{asc("Active"), asc("Role"), desc("Age")}}, true},
+		{"equalities in another order", Index{Kind: "User", Properties: []IndexProperty{asc("Role"), asc("Active"), desc("Age")}}, true},
+		{"equality descending", Index{Kind: "User", Properties: []IndexProperty{desc("Active"), asc("Role"), desc("Age")}}, true},
+		{"sort direction differs", Index{Kind: "User", Properties: []IndexProperty{asc("Active"), asc("Role"), asc("Age")}}, false},
+		{"sort before equality", Index{Kind: "User", Properties: []IndexProperty{asc("Active"), desc("Age"), asc("Role")}}, false},
+		{"other kind", Index{Kind: "Order", Properties: []IndexProperty{asc("Active"), asc("Role"), desc("Age")}}, false},
+		{"with ancestor", Index{Kind: "User", Ancestor: true, Properties: []IndexProperty{asc("Active"), asc("Role"), desc("Age")}}, false},
+		{"missing a property", Index{Kind: "User", Properties: []IndexProperty{asc("Active"), desc("Age")}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.declared.Serves(required); got != tt.want {
+				t.Errorf("%s serves %s = %v, want %v", tt.declared, required, got, tt.want)
+			}
+		})
+	}
+
+	sorted := Index{Kind: "User", Properties: []IndexProperty{asc("Name"), desc("Age")}}
+	for _, declared := range []Index{
+		{Kind: "User", Properties: []IndexProperty{desc("Age"), asc("Name")}},
+		{Kind: "User", Properties: []IndexProperty{asc("Name"), asc("Age")}},
+	} {
+		if declared.Serves(sorted) {
+			t.Errorf("%s serves %s, want the sort orders to match exactly", declared, sorted)
+		}
+	}
+}
+
+func TestLoadIndexesAndMissingIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.yaml")
+	yaml := `indexes:
+
+- kind: User
+  properties:
+  - name: Active
+  - name: Age
+    direction: desc
+
+- kind: User
+  ancestor: yes
+  properties:
+  - name: Name
+    direction: DESCENDING
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexes, err := LoadIndexes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Index{
+		{Kind: "User", Properties: []IndexProperty{asc("Active"), desc("Age")}},
+		{Kind: "User", Ancestor: true, Properties: []IndexProperty{desc("Name")}},
+	}
+	if !reflect.DeepEqual(indexes, want) {
+		t.Fatalf("LoadIndexes = %v, want %v", indexes, want)
+	}
+
+	served := EntityQuery{Kind: "User", Filters: []Filter{{Property: "Active", Operator: "=", Value: "true", Type: TypeBool}},
+		Orders: []Order{{"Age", "desc"}}}
+	if idx, missing := MissingIndex(served, indexes); missing {
+		t.Errorf("MissingIndex = %s, want the declared index to serve it", idx)
+	}
+	reversed := served
+	reversed.Orders = []Order{{"Age", "asc"}}
+	if _, missing := MissingIndex(reversed, indexes); !missing {
+		t.Errorf("MissingIndex found no index missing for an ascending sort on Age, the declared one is descending")
+	}
+
+	for _, bad := range []struct{ yaml, want string }{
+		{"indexes:\n- properties:\n  - name: Age\n", "index 1 has no kind"},
+		{"indexes:\n- kind: User\n  ancestor: maybe\n", "ancestor must be yes or no"},
+		{"indexes: [", "reading"},
+	} {
+		if err := os.WriteFile(path, []byte(bad.yaml), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadIndexes(path); err == nil || !strings.Contains(err.Error(), bad.want) {
+			t.Errorf("LoadIndexes(%q) error = %v, want it to contain %q", bad.yaml, err, bad.want)
+		}
+	}
+}
+
+func TestIndexYAML(t *testing.T) {
+	got := IndexYAML([]Index{
+		{Kind: "User", Properties: []IndexProperty{asc("Active"), desc("Age")}},
+		{Kind: "Order", Ancestor: true, Properties: []IndexProperty{asc("Address.City"), desc("__key__")}},
+	})
+	want := `indexes:
+
+- kind: User
+  properties:
+  - name: Active
+  - name: Age
+    direction: desc
+
+- kind: Order
+  ancestor: yes
+  properties:
+  - name: Address.City
+  - name: __key__
+    direction: desc
+`
+	if got != want {
+		t.Errorf("IndexYAML =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestYAMLName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Age", "Age"},
+		{"Address.City", "Address.City"},
+		{"first name", "first name"},
+		{"yes", `"yes"`},
+		{"Off", `"Off"`},
+		{"null", `"null"`},
+		{"123", `"123"`},
+		{"1.5", `"1.5"`},
+		{"a: b", `"a: b"`},
+		{"#tag", `"#tag"`},
+		{"[list]", `"[list]"`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := yamlName(tt.name); got != tt.want {
+			t.Errorf("yamlName(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// jsonProperty is the wire form of an OutputProperty. Indexed defaults to true
+// when left out.
+type jsonProperty struct {
+	Name    string          `json:"name"`
+	Value   json.RawMessage `json:"value"`
+	TypeOf  string          `json:"type"`
+	Indexed *bool           `json:"indexed,omitempty"`
+}
+
+type jsonGeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// MarshalJSON writes the value in a form that keeps its type: keys are encoded,
+// times are RFC 3339, blobs are base64, GeoPoints are {"lat", "lng"}, nested
+// entities are objects of properties and array elements are unnamed properties
+func (p OutputProperty) MarshalJSON() ([]byte, error) {
+	p = normalizeProperty(p)
+
+	var value interface{}
+	switch v := p.Value.(type) {
+	case *datastore.Key:
+		if v != nil {
+			value = v.Encode()
+		}
+	case time.Time:
+		value = v.Format(time.RFC3339Nano)
+	case datastore.GeoPoint:
+		value = jsonGeoPoint{Lat: v.Lat, Lng: v.Lng}
+	case []byte:
+		value = base64.StdEncoding.EncodeToString(v)
+	case []interface{}:
+		items := make([]OutputProperty, len(v))
+		for i, item := range v {
+			items[i] = normalizeProperty(OutputProperty{Value: item, TypeOf: fmt.Sprintf("%T", item), Indexed: p.Indexed})
+		}
+		value = items
+	default:
+		value = v
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("property %s: %s", p.Name, err)
+	}
+	return json.Marshal(jsonProperty{
+		Name:    p.Name,
+		Value:   raw,
+		TypeOf:  p.TypeOf,
+		Indexed: &p.Indexed,
+	})
+}
+
+// normalizeProperty converts nested entities that Load left as *datastore.Entity,
+// which happens inside arrays
+func normalizeProperty(p OutputProperty) OutputProperty {
+	if e, ok := p.Value.(*datastore.Entity); ok && e != nil {
+		nested := GeneralEntity{}
+		nested.Load(e.Properties)
+		p.Value = nested
+		p.TypeOf = TypeEntity
+	}
+	return p
+}
+
+// UnmarshalJSON is the inverse of MarshalJSON. A string, number, bool or null
+// value may leave out its type, numbers without a fraction are read as int64.
+func (p *OutputProperty) UnmarshalJSON(data []byte) error {
+	var jp jsonProperty
+	if err := json.Unmarshal(data, &jp); err != nil {
+		return fmt.Errorf("expected {\"value\", \"type\", \"indexed\"}, got %s", data)
+	}
+	if jp.TypeOf == "" {
+		jp.TypeOf = inferJSONType(jp.Value)
+	}
+
+	value, err := valueFromJSON(jp.TypeOf, jp.Value)
+	if err != nil {
+		return err
+	}
+	*p = OutputProperty{
+		Name:    jp.Name,
+		Value:   value,
+		TypeOf:  jp.TypeOf,
+		Indexed: jp.Indexed == nil || *jp.Indexed,
+	}
+	return nil
+}
+
+// UnmarshalJSON reads an object of properties, names default to the object keys
+func (ge *GeneralEntity) UnmarshalJSON(data []byte) error {
+	var props map[string]json.RawMessage
+	if err := json.Unmarshal(data, &props); err != nil {
+		return err
+	}
+	*ge = make(GeneralEntity, len(props))
+	for name, raw := range props {
+		var p OutputProperty
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return fmt.Errorf("property %s: %s", name, err)
+		}
+		p.Name = name
+		(*ge)[name] = p
+	}
+	return nil
+}
+
+func inferJSONType(raw json.RawMessage) string {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return ""
+	}
+	switch v.(type) {
+	case string:
+		return TypeString
+	case bool:
+		return TypeBool
+	case float64:
+		var n json.Number
+		json.Unmarshal(raw, &n)
+		if _, err := n.Int64(); err == nil {
+			return TypeInt64
+		}
+		return TypeFloat64
+	case nil:
+		return TypeNull
+	default:
+		return ""
+	}
+}
+
+func valueFromJSON(typeOf string, raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 {
+		raw = json.RawMessage("null")
+	}
+
+	switch typeOf {
+	case TypeInt64:
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, fmt.Errorf("invalid int64 %s", raw)
+		}
+		return ParsePropertyValue(typeOf, n.String())
+	case TypeFloat64:
+		var v float64
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("invalid float64 %s", raw)
+		}
+		return v, nil
+	case TypeBool:
+		var v bool
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("invalid bool %s", raw)
+		}
+		return v, nil
+	case TypeString, TypeTime, TypeBytes, TypeKey:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("invalid %s %s, expected a string", typeOf, raw)
+		}
+		return ParsePropertyValue(typeOf, s)
+	case TypeGeoPoint:
+		var g jsonGeoPoint
+		if err := json.Unmarshal(raw, &g); err != nil {
+			return nil, fmt.Errorf("invalid GeoPoint %s, expected {\"lat\", \"lng\"}", raw)
+		}
+		p := datastore.GeoPoint{Lat: g.Lat, Lng: g.Lng}
+		if !p.Valid() {
+			return nil, fmt.Errorf("GeoPoint %s out of range", raw)
+		}
+		return p, nil
+	case TypeEntity:
+		var e GeneralEntity
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case TypeArray:
+		var items []OutputProperty
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			if item.TypeOf == TypeArray {
+				return nil, fmt.Errorf("arrays cannot contain arrays")
+			}
+			values[i] = item.Value
+		}
+		return values, nil
+	case TypeNull:
+		return nil, nil
+	case "":
+		return nil, fmt.Errorf("type is required for value %s", raw)
+	default:
+		return nil, fmt.Errorf("unsupported type %s", typeOf)
+	}
+}
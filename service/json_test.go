@@ -0,0 +1,121 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+func TestEntityJSONRoundTrip(t *testing.T) {
+	parent := datastore.NameKey("User", "alice", nil)
+	parent.Namespace = "ns"
+	key := datastore.IDKey("Purchase", 7, parent)
+	key.Namespace = "ns"
+	prop := func(name string, value interface{}, typeOf string, indexed bool) OutputProperty {
+		return OutputProperty{Name: name, Value: value, TypeOf: typeOf, Indexed: indexed}
+	}
+	address := GeneralEntity{
+		"City": prop("City", "Paris", TypeString, true),
+		"Zip":  prop("Zip", int64(75001), TypeInt64, false),
+	}
+	entity := GeneralEntity{
+		"Age":     prop("Age", int64(42), TypeInt64, true),
+		"Score":   prop("Score", 2.0, TypeFloat64, true),
+		"Active":  prop("Active", false, TypeBool, true),
+		"Notes":   prop("Notes", "long text", TypeString, false),
+		"Owner":   prop("Owner", key, TypeKey, true),
+		"Created": prop("Created", time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC), TypeTime, true),
+		"Avatar":  prop("Avatar", []byte{0, 1, 2, 255}, TypeBytes, false),
+		"Loc":     prop("Loc", datastore.GeoPoint{Lat: 48.85, Lng: -2.35}, TypeGeoPoint, true),
+		"Address": prop("Address", address, TypeEntity, false),
+		"Tags":    prop("Tags", []interface{}{"a", int64(1), key, address}, TypeArray, true),
+		"Deleted": prop("Deleted", nil, TypeNull, true),
+	}
+
+	data, err := json.Marshal(entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got GeneralEntity
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", data, err)
+	}
+	for name, want := range entity {
+		if !reflect.DeepEqual(got[name], want) {
+			t.Errorf("%s = %#v, want %#v", name, got[name], want)
+		}
+	}
+	if len(got) != len(entity) {
+		t.Errorf("got %d properties, want %d", len(got), len(entity))
+	}
+}
+
+func TestEntityJSONNestedFromLoad(t *testing.T) {
+	// Load leaves entities inside arrays as *datastore.Entity
+	var loaded GeneralEntity
+	if err := loaded.Load([]datastore.Property{{
+		Name: "Items",
+		Value: []interface{}{&datastore.Entity{Properties: []datastore.Property{
+			{Name: "Sku", Value: "x1", NoIndex: true},
+		}}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got GeneralEntity
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", data, err)
+	}
+	want := []interface{}{GeneralEntity{"Sku": {Name: "Sku", Value: "x1", TypeOf: TypeString, Indexed: false}}}
+	if items := got["Items"]; items.TypeOf != TypeArray || !reflect.DeepEqual(items.Value, want) {
+		t.Errorf("Items = %#v, want %#v", items, want)
+	}
+}
+
+func TestEntityJSONInference(t *testing.T) {
+	var got GeneralEntity
+	data := `{"Name": {"value": "Ann"}, "Age": {"value": 3}, "Score": {"value": 1.5},
+		"Active": {"value": true}, "Deleted": {"value": null}, "Notes": {"value": "x", "indexed": false}}`
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := GeneralEntity{
+		"Name":    {Name: "Name", Value: "Ann", TypeOf: TypeString, Indexed: true},
+		"Age":     {Name: "Age", Value: int64(3), TypeOf: TypeInt64, Indexed: true},
+		"Score":   {Name: "Score", Value: 1.5, TypeOf: TypeFloat64, Indexed: true},
+		"Active":  {Name: "Active", Value: true, TypeOf: TypeBool, Indexed: true},
+		"Deleted": {Name: "Deleted", Value: nil, TypeOf: TypeNull, Indexed: true},
+		"Notes":   {Name: "Notes", Value: "x", TypeOf: TypeString, Indexed: false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal(%s) = %v, want %v", data, got, want)
+	}
+}
+
+func TestEntityJSONErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{"A": 3}`, "expected {"},
+		{`{"A": {"value": [1]}}`, "type is required"},
+		{`{"A": {"value": 1, "type": "complex128"}}`, "unsupported type complex128"},
+		{`{"A": {"value": "x", "type": "int64"}}`, "invalid int64"},
+		{`{"A": {"value": "yesterday", "type": "time.Time"}}`, "time"},
+		{`{"A": {"value": {"lat": 91, "lng": 0}, "type": "datastore.GeoPoint"}}`, "out of range"},
+		{`{"A": {"value": [{"value": [], "type": "[]interface {}"}], "type": "[]interface {}"}}`, "arrays cannot contain arrays"},
+	}
+	for _, tt := range tests {
+		var got GeneralEntity
+		if err := json.Unmarshal([]byte(tt.data), &got); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Unmarshal(%s) error = %v, want it to contain %q", tt.data, err, tt.want)
+		}
+	}
+}
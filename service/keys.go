@@ -0,0 +1,92 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// KeyElements lists key and its ancestors, root first
+func KeyElements(key *datastore.Key) []*datastore.Key {
+	var elements []*datastore.Key
+	for k := key; k != nil; k = k.Parent {
+		elements = append([]*datastore.Key{k}, elements...)
+	}
+	return elements
+}
+
+// KeyIDOrName is the name of key, or its numeric ID
+func KeyIDOrName(key *datastore.Key) string {
+	if key.Name != "" {
+		return key.Name
+	}
+	return strconv.FormatInt(key.ID, 10)
+}
+
+// KeyElement is one element of a key path, Kind:123 or Kind:"name"
+func KeyElement(key *datastore.Key) string {
+	if key.Name != "" {
+		return key.Kind + ":" + strconv.Quote(key.Name)
+	}
+	return key.Kind + ":" + strconv.FormatInt(key.ID, 10)
+}
+
+// KeyPath is the path of key from its root, Parent:123 > Child:"abc", after
+// the namespace when it has one
+func KeyPath(key *datastore.Key) string {
+	if key == nil {
+		return ""
+	}
+	var parts []string
+	for _, k := range KeyElements(key) {
+		parts = append(parts, KeyElement(k))
+	}
+	path := strings.Join(parts, " > ")
+	if key.Namespace != "" {
+		path = key.Namespace + ": " + path
+	}
+	return path
+}
+
+// GoKeyLiteral is the Go expression building key with the datastore package
+func GoKeyLiteral(key *datastore.Key) string {
+	if key == nil {
+		return "nil"
+	}
+	parent := GoKeyLiteral(key.Parent)
+	if key.Namespace != "" {
+		id := fmt.Sprintf("ID: %d", key.ID)
+		if key.Name != "" {
+			id = fmt.Sprintf("Name: %q", key.Name)
+		}
+		return fmt.Sprintf("&datastore.Key{Kind: %q, %s, Parent: %s, Namespace: %q}", key.Kind, id, parent, key.Namespace)
+	}
+	if key.Name != "" {
+		return fmt.Sprintf("datastore.NameKey(%q, %q, %s)", key.Kind, key.Name, parent)
+	}
+	return fmt.Sprintf("datastore.IDKey(%q, %d, %s)", key.Kind, key.ID, parent)
+}
+
+// PythonKeyLiteral is the Python expression building key with google-cloud-datastore
+func PythonKeyLiteral(key *datastore.Key) string {
+	var args []string
+	for _, k := range KeyElements(key) {
+		id := strconv.FormatInt(k.ID, 10)
+		if k.Name != "" {
+			id = pythonString(k.Name)
+		}
+		args = append(args, pythonString(k.Kind), id)
+	}
+	if key.Namespace != "" {
+		args = append(args, "namespace="+pythonString(key.Namespace))
+	}
+	return "client.key(" + strings.Join(args, ", ") + ")"
+}
+
+// pythonString quotes s as a Python string literal
+func pythonString(s string) string {
+	// The escapes Go uses are valid in Python too
+	return strconv.Quote(s)
+}
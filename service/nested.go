@@ -0,0 +1,94 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ValueNode is a property value laid out for display. Nested entities have
+// their properties as Children, in name order, arrays their elements.
+type ValueNode struct {
+	Name     string // property name, or [i] for array elements
+	Type     string
+	Value    interface{}
+	Text     string // text form of scalar values
+	Indexed  bool
+	Children []ValueNode
+}
+
+// NewValueNode lays out p and everything nested in it
+func NewValueNode(p OutputProperty) ValueNode {
+	p = normalizeProperty(p)
+	n := ValueNode{Name: p.Name, Type: p.TypeOf, Value: p.Value, Indexed: p.Indexed}
+	switch v := p.Value.(type) {
+	case GeneralEntity:
+		for _, name := range v.Names() {
+			n.Children = append(n.Children, NewValueNode(v[name]))
+		}
+	case []interface{}:
+		for i, item := range v {
+			n.Children = append(n.Children, NewValueNode(OutputProperty{
+				Name:    fmt.Sprintf("[%d]", i),
+				Value:   item,
+				TypeOf:  fmt.Sprintf("%T", item),
+				Indexed: p.Indexed,
+			}))
+		}
+	default:
+		n.Text, _ = stringifyInterface(v)
+	}
+	return n
+}
+
+// Nested tells whether the node is an entity or an array
+func (n ValueNode) Nested() bool {
+	return n.Type == TypeEntity || n.Type == TypeArray
+}
+
+// Summary is the collapsed form of a nested node
+func (n ValueNode) Summary() string {
+	if n.Type == TypeArray {
+		return fmt.Sprintf("[%d items]", len(n.Children))
+	}
+	return fmt.Sprintf("{%d properties}", len(n.Children))
+}
+
+// JSON is the value as indented plain JSON
+func (n ValueNode) JSON() string {
+	return ValueJSON(n.Value)
+}
+
+// ValueJSON is v as indented plain JSON, without the types MarshalJSON keeps
+func ValueJSON(v interface{}) string {
+	data, err := json.MarshalIndent(PlainValue(v), "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// TypeLabel is the short name of a property type shown in badges
+func TypeLabel(typeOf string) string {
+	switch typeOf {
+	case TypeInt64:
+		return "int"
+	case TypeFloat64:
+		return "float"
+	case TypeTime:
+		return "time"
+	case TypeGeoPoint:
+		return "geo"
+	case TypeBytes:
+		return "blob"
+	case TypeKey:
+		return "key"
+	case TypeEntity, "*datastore.Entity":
+		return "entity"
+	case TypeArray:
+		return "array"
+	case TypeNull:
+		return "null"
+	default:
+		return typeOf
+	}
+}
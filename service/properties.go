@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Property representations reported by __property__
+const (
+	RepresentationInt64     = "INT64"
+	RepresentationDouble    = "DOUBLE"
+	RepresentationBoolean   = "BOOLEAN"
+	RepresentationString    = "STRING"
+	RepresentationPoint     = "POINT"
+	RepresentationReference = "REFERENCE"
+	RepresentationNull      = "NULL"
+)
+
+// representationTypes maps each representation to the types its values load
+// as, the most common first. Times are stored as INT64 and blobs as STRING.
+var representationTypes = map[string][]string{
+	RepresentationInt64:     {TypeInt64, TypeTime},
+	RepresentationDouble:    {TypeFloat64},
+	RepresentationBoolean:   {TypeBool},
+	RepresentationString:    {TypeString, TypeBytes},
+	RepresentationPoint:     {TypeGeoPoint},
+	RepresentationReference: {TypeKey},
+	RepresentationNull:      {TypeNull},
+}
+
+// KindProperty is an indexed property of a kind as __property__ reports it.
+// Properties of embedded entities are named Parent.Child.
+type KindProperty struct {
+	Kind            string
+	Name            string
+	Representations []string
+}
+
+// Has tells whether some value of the property has the representation
+func (p KindProperty) Has(representation string) bool {
+	return slices.Contains(p.Representations, representation)
+}
+
+// Types lists the types the values of the property may load as
+func (p KindProperty) Types() []string {
+	var types []string
+	for _, r := range p.Representations {
+		for _, t := range representationTypes[r] {
+			if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+// Embedded is the property holding the embedded entity the property is part of,
+// empty for top level properties
+func (p KindProperty) Embedded() string {
+	parent, _, ok := strings.Cut(p.Name, ".")
+	if !ok {
+		return ""
+	}
+	return parent
+}
+
+// GetKindProperties lists the indexed properties of kind by name. Unindexed
+// properties are not kept in __property__.
+func GetKindProperties(ctx context.Context, client *datastore.Client, namespace string, kind string) ([]KindProperty, error) {
+	query := datastore.NewQuery("__property__").Namespace(namespace).
+		Ancestor(datastore.NameKey("__kind__", kind, nil))
+	properties, err := getProperties(ctx, client, query)
+	if err != nil {
+		return nil, fmt.Errorf("reading __property__ of %s: %s", kind, err)
+	}
+	return properties, nil
+}
+
+// GetNamespaceProperties lists the indexed properties of every kind of namespace
+func GetNamespaceProperties(ctx context.Context, client *datastore.Client, namespace string) (map[string][]KindProperty, error) {
+	properties, err := getProperties(ctx, client, datastore.NewQuery("__property__").Namespace(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("reading __property__: %s", err)
+	}
+	byKind := map[string][]KindProperty{}
+	for _, p := range properties {
+		byKind[p.Kind] = append(byKind[p.Kind], p)
+	}
+	return byKind, nil
+}
+
+func getProperties(ctx context.Context, client *datastore.Client, query *datastore.Query) ([]KindProperty, error) {
+	var rows []struct {
+		Representation []string `datastore:"property_representation"`
+	}
+	keys, err := client.GetAll(ctx, query, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make([]KindProperty, 0, len(keys))
+	for i, key := range keys {
+		if key.Parent == nil {
+			continue
+		}
+		representations := slices.Clone(rows[i].Representation)
+		sort.Strings(representations)
+		properties = append(properties, KindProperty{
+			Kind:            key.Parent.Name,
+			Name:            key.Name,
+			Representations: representations,
+		})
+	}
+	sort.Slice(properties, func(i, j int) bool {
+		if properties[i].Kind != properties[j].Kind {
+			return properties[i].Kind < properties[j].Kind
+		}
+		return properties[i].Name < properties[j].Name
+	})
+	return properties, nil
+}
+
+// PropertyHeaders turns the properties of a kind into table columns. Properties
+// of embedded entities are listed as Parent.Child and go in the column of Parent.
+func PropertyHeaders(properties []KindProperty) []TableHeader {
+	seen := map[string]bool{"key": true}
+	headers := []TableHeader{{Name: "key", Type: TypeKey}}
+	for _, p := range properties {
+		name := p.Name
+		if parent := p.Embedded(); parent != "" {
+			name = parent
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		h := TableHeader{Name: name, Type: TypeNull}
+		if name != p.Name {
+			h.Type = TypeEntity
+		} else if i := slices.IndexFunc(p.Types(), func(t string) bool { return t != TypeNull }); i >= 0 {
+			h.Type = p.Types()[i]
+		}
+		headers = append(headers, h)
+	}
+	sortHeaders(headers)
+	return headers
+}
+
+// MergeHeaders adds the columns of page to known. The page knows the types of its
+// values better, its headers replace the known ones of the same name, except that
+// a page with only nulls in a column keeps the known type.
+func MergeHeaders(known []TableHeader, page []TableHeader) []TableHeader {
+	merged := make([]TableHeader, 0, len(known)+len(page))
+	byName := make(map[string]int, len(known))
+	for _, h := range known {
+		byName[h.Name] = len(merged)
+		merged = append(merged, h)
+	}
+	for _, h := range page {
+		if i, ok := byName[h.Name]; ok {
+			if h.Type == TypeNull {
+				h.Type = merged[i].Type
+			}
+			merged[i] = h
+		} else {
+			merged = append(merged, h)
+		}
+	}
+	sortHeaders(merged)
+	return merged
+}
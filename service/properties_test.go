@@ -0,0 +1,24 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeHeaders(t *testing.T) {
+	known := []TableHeader{{Name: "key", Type: TypeKey}, {Name: "Age", Type: TypeInt64}, {Name: "Name", Type: TypeString}}
+	page := []TableHeader{
+		{Name: "Name", Type: TypeNull},
+		{Name: "Age", Type: TypeFloat64},
+		{Name: "Body", Type: TypeString, Unindexed: true},
+	}
+	want := []TableHeader{
+		{Name: "key", Type: TypeKey},
+		{Name: "Age", Type: TypeFloat64},
+		{Name: "Body", Type: TypeString, Unindexed: true},
+		{Name: "Name", Type: TypeString},
+	}
+	if got := MergeHeaders(known, page); !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeHeaders = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// FilterOperators lists the comparison operators a filter can use
+var FilterOperators = []string{"=", "<", "<=", ">", ">=", "!=", "IN", "NOT IN"}
+
+// Filter is a condition on a property, Value holds the text form of a value of type Type
+type Filter struct {
+	Property string
+	Operator string
+	Value    string
+	Type     string
+}
+
+// ParsedValue converts the filter value to Type, IN and NOT IN take a comma separated list
+func (f Filter) ParsedValue() (interface{}, error) {
+	if f.Operator != "IN" && f.Operator != "NOT IN" {
+		return ParsePropertyValue(f.Type, f.Value)
+	}
+
+	var values []interface{}
+	for _, raw := range strings.Split(f.Value, ",") {
+		value, err := ParsePropertyValue(f.Type, strings.TrimSpace(raw))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (f Filter) String() string {
+	return fmt.Sprintf("%s %s %s", f.Property, f.Operator, f.Value)
+}
+
+// Order sorts by a property, Direction is "asc" or "desc"
+type Order struct {
+	Property  string
+	Direction string
+}
+
+func (o Order) String() string {
+	if o.Direction == "desc" {
+		return "-" + o.Property
+	}
+	return o.Property
+}
+
+// EntityQuery describes a page of entities of one kind
+type EntityQuery struct {
+	Namespace string
+	Kind      string
+	Filters   []Filter
+	Ancestor  *datastore.Key // only descendants of Ancestor, when set
+	Orders    []Order        // the first order sorts first
+	Limit     int
+	Cursor    string
+}
+
+// String describes the query for people, without limit and cursor
+func (q EntityQuery) String() string {
+	var b strings.Builder
+	b.WriteString(q.Kind)
+	if q.Ancestor != nil {
+		fmt.Fprintf(&b, " under %s", KeyPath(q.Ancestor))
+	}
+	for i, f := range q.Filters {
+		if i == 0 {
+			b.WriteString(" where ")
+		} else {
+			b.WriteString(" and ")
+		}
+		b.WriteString(f.String())
+	}
+	for i, o := range q.Orders {
+		if i == 0 {
+			b.WriteString(" order by ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(o.String())
+	}
+	return b.String()
+}
+
+// Build turns the query into a Datastore query, without limit and cursor
+func (q EntityQuery) Build() (*datastore.Query, error) {
+	query := datastore.NewQuery(q.Kind).Namespace(q.Namespace)
+	if q.Ancestor != nil {
+		query = query.Ancestor(q.Ancestor)
+	}
+	for _, f := range q.Filters {
+		value, err := f.ParsedValue()
+		if err != nil {
+			return nil, fmt.Errorf("filter %s: %s", f, err)
+		}
+		query = query.FilterField(propertyField(f.Property), fieldOperator(f.Operator), value)
+	}
+	for _, o := range q.Orders {
+		if o.Direction == "desc" {
+			query = query.Order("-" + propertyField(o.Property))
+		} else {
+			query = query.Order(propertyField(o.Property))
+		}
+	}
+	return query, nil
+}
+
+// propertyField maps a table column to the field name Datastore queries expect
+func propertyField(name string) string {
+	if name == "key" {
+		return "__key__"
+	}
+	return strconv.Quote(name)
+}
+
+func fieldOperator(op string) string {
+	switch op {
+	case "IN":
+		return "in"
+	case "NOT IN":
+		return "not-in"
+	default:
+		return op
+	}
+}
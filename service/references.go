@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+)
+
+// maxReferences is how many referencing entities are listed per kind and property
+const maxReferences = 100
+
+// getMultiBatchSize is the largest number of keys Datastore looks up at once
+const getMultiBatchSize = 1000
+
+// Reference lists entities of kind Kind whose property Property holds a key
+type Reference struct {
+	Kind     string
+	Property string
+	Keys     []*datastore.Key
+	More     bool // there are more than Keys
+}
+
+// ReferencedKeys collects the keys held by the properties of entities, the
+// synthetic key column and nested entities aside
+func ReferencedKeys(entities []GeneralEntity) []*datastore.Key {
+	var keys []*datastore.Key
+	for _, e := range entities {
+		for name, prop := range e {
+			if name == "key" {
+				continue
+			}
+			switch v := prop.Value.(type) {
+			case *datastore.Key:
+				keys = append(keys, v)
+			case []interface{}:
+				for _, item := range v {
+					if k, ok := item.(*datastore.Key); ok {
+						keys = append(keys, k)
+					}
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// MissingKeys looks up keys and returns the encoded ones that have no entity
+func MissingKeys(ctx context.Context, client *datastore.Client, keys []*datastore.Key) (map[string]bool, error) {
+	seen := map[string]bool{}
+	var unique []*datastore.Key
+	for _, k := range keys {
+		if k == nil || k.Incomplete() || seen[k.Encode()] {
+			continue
+		}
+		seen[k.Encode()] = true
+		unique = append(unique, k)
+	}
+
+	missing := map[string]bool{}
+	for start := 0; start < len(unique); start += getMultiBatchSize {
+		batch := unique[start:min(start+getMultiBatchSize, len(unique))]
+		err := client.GetMulti(ctx, batch, make([]GeneralEntity, len(batch)))
+
+		var multiErr datastore.MultiError
+		if errors.As(err, &multiErr) {
+			for i, err := range multiErr {
+				switch err {
+				case nil:
+				case datastore.ErrNoSuchEntity:
+					missing[batch[i].Encode()] = true
+				default:
+					return nil, err
+				}
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// FindReferences finds the entities holding key in an indexed property. Only
+// entities in the namespace of key are searched.
+func FindReferences(ctx context.Context, client *datastore.Client, key *datastore.Key) ([]Reference, error) {
+	properties, err := GetNamespaceProperties(ctx, client, key.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	kinds, err := GetAllKinds(ctx, client, key.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var references []Reference
+	for _, kind := range kinds {
+		for _, p := range properties[kind] {
+			if !p.Has(RepresentationReference) {
+				continue
+			}
+			property := p.Name
+			query := datastore.NewQuery(kind).Namespace(key.Namespace).
+				FilterField(propertyField(property), "=", key).
+				KeysOnly().
+				Limit(maxReferences + 1)
+			keys, err := client.GetAll(ctx, query, nil)
+			if err != nil {
+				return nil, err
+			}
+			if len(keys) == 0 {
+				continue
+			}
+			references = append(references, Reference{
+				Kind:     kind,
+				Property: property,
+				Keys:     keys[:min(len(keys), maxReferences)],
+				More:     len(keys) > maxReferences,
+			})
+		}
+	}
+	return references, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"cloud.google.com/go/datastore"
+)
+
+// maxSchemaExamples is how many distinct example values are kept per property type
+const maxSchemaExamples = 3
+
+// TypeCount is how many scanned entities have a property of type Type
+type TypeCount struct {
+	Type     string
+	Count    int
+	Examples []string
+}
+
+// PropertySchema is what a scan found out about one property of a kind
+type PropertySchema struct {
+	Name      string
+	Types     []TypeCount // most frequent first
+	Present   int         // entities having the property, null or not
+	Null      int
+	Indexed   int
+	Unindexed int
+}
+
+// Mixed tells whether the property has more than one type, null aside
+func (p PropertySchema) Mixed() bool {
+	types := 0
+	for _, t := range p.Types {
+		if t.Type != TypeNull {
+			types++
+		}
+	}
+	return types > 1
+}
+
+// KindSchema lists the properties found in the scanned entities of a kind
+type KindSchema struct {
+	Namespace  string
+	Kind       string
+	Scanned    int
+	Complete   bool // every entity of the kind was scanned
+	Properties []PropertySchema
+}
+
+// Missing is how many scanned entities do not have the property at all
+func (s *KindSchema) Missing(p PropertySchema) int {
+	return s.Scanned - p.Present
+}
+
+// InspectKind scans up to sample entities of kind, the whole kind when sample is 0
+func InspectKind(ctx context.Context, client *datastore.Client, namespace string, kind string, sample int) (*KindSchema, error) {
+	schema := &KindSchema{Namespace: namespace, Kind: kind}
+	properties := map[string]*PropertySchema{}
+
+	query := datastore.NewQuery(kind).Namespace(namespace)
+	// Reading one entity more than the sample tells whether the kind was scanned completely
+	limit := 0
+	if sample > 0 {
+		limit = sample + 1
+	}
+	read, err := EachEntity(ctx, client, query, 0, limit, func(e GeneralEntity) error {
+		if sample > 0 && schema.Scanned == sample {
+			return nil
+		}
+		schema.Scanned++
+		for name, prop := range e {
+			if name == "key" {
+				continue
+			}
+			p, ok := properties[name]
+			if !ok {
+				p = &PropertySchema{Name: name}
+				properties[name] = p
+			}
+			p.add(e, prop)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	schema.Complete = read == schema.Scanned
+
+	for _, p := range properties {
+		sort.SliceStable(p.Types, func(i, j int) bool { return p.Types[i].Count > p.Types[j].Count })
+		schema.Properties = append(schema.Properties, *p)
+	}
+	sort.Slice(schema.Properties, func(i, j int) bool {
+		return schema.Properties[i].Name < schema.Properties[j].Name
+	})
+	return schema, nil
+}
+
+func (p *PropertySchema) add(e GeneralEntity, prop OutputProperty) {
+	p.Present++
+	if prop.TypeOf == TypeNull {
+		p.Null++
+	}
+	if prop.Indexed {
+		p.Indexed++
+	} else {
+		p.Unindexed++
+	}
+
+	i := slices.IndexFunc(p.Types, func(t TypeCount) bool { return t.Type == prop.TypeOf })
+	if i < 0 {
+		p.Types = append(p.Types, TypeCount{Type: prop.TypeOf})
+		i = len(p.Types) - 1
+	}
+	t := &p.Types[i]
+	t.Count++
+	if len(t.Examples) < maxSchemaExamples {
+		if example, err := e.GetString(prop.Name); err == nil && !slices.Contains(t.Examples, example) {
+			t.Examples = append(t.Examples, example)
+		}
+	}
+}
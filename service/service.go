@@ -41,9 +41,24 @@ func NewDatastoreClient(ctx context.Context) (*datastore.Client, error) {
 	return client, nil
 }
 
-// GetAllKinds retrieves all kinds from Datastore
-func GetAllKinds(ctx context.Context, client *datastore.Client) ([]string, error) {
-	query := datastore.NewQuery("__kind__").KeysOnly()
+// GetAllNamespaces retrieves all namespaces from Datastore, the default namespace is ""
+func GetAllNamespaces(ctx context.Context, client *datastore.Client) ([]string, error) {
+	query := datastore.NewQuery("__namespace__").KeysOnly()
+	keys, err := client.GetAll(ctx, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces []string
+	for _, key := range keys {
+		namespaces = append(namespaces, key.Name)
+	}
+	return namespaces, nil
+}
+
+// GetAllKinds retrieves all kinds of a namespace from Datastore
+func GetAllKinds(ctx context.Context, client *datastore.Client, namespace string) ([]string, error) {
+	query := datastore.NewQuery("__kind__").Namespace(namespace).KeysOnly()
 	keys, err := client.GetAll(ctx, query, nil)
 	if err != nil {
 		return nil, err
@@ -57,8 +72,9 @@ func GetAllKinds(ctx context.Context, client *datastore.Client) ([]string, error
 }
 
 type TableHeader struct {
-	Name string
-	Type string
+	Name      string
+	Type      string // most frequent type of the column, null aside
+	Unindexed bool   // some value of the column is not indexed
 }
 
 type OutputProperty struct {
@@ -96,13 +112,74 @@ func (x *GeneralEntity) Load(ps []datastore.Property) error {
 }
 
 func (x *GeneralEntity) Save() ([]datastore.Property, error) {
+	names := make([]string, 0, len(*x))
+	for name := range *x {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	props := make([]datastore.Property, 0, len(names))
+	for _, name := range names {
+		prop := (*x)[name]
+		value, err := toDatastoreValue(prop.Value)
+		if err != nil {
+			return nil, fmt.Errorf("property %s: %s", name, err)
+		}
+		props = append(props, datastore.Property{
+			Name:    name,
+			Value:   value,
+			NoIndex: !prop.Indexed,
+		})
+	}
+
+	return props, nil
+}
+
+// Names lists the property names in order, the synthetic key column first
+func (ge GeneralEntity) Names() []string {
+	names := make([]string, 0, len(ge))
+	for name := range ge {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == "key" || names[j] == "key" {
+			return names[i] == "key"
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// Key returns the key GetAllEntities stores in the synthetic key column
+func (ge GeneralEntity) Key() *datastore.Key {
+	k, _ := ge["key"].Value.(*datastore.Key)
+	return k
+}
 
-	return []datastore.Property{
-		{
-			Name:  "I",
-			Value: x,
-		},
-	}, nil
+func toDatastoreValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case GeneralEntity:
+		props, err := v.Save()
+		if err != nil {
+			return nil, err
+		}
+		return &datastore.Entity{Properties: props}, nil
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			if _, ok := item.([]interface{}); ok {
+				return nil, fmt.Errorf("arrays cannot contain arrays")
+			}
+			value, err := toDatastoreValue(item)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	default:
+		return v, nil
+	}
 }
 
 func (ge GeneralEntity) GetValue(prop OutputProperty) (interface{}, error) {
@@ -122,7 +199,7 @@ func (ge GeneralEntity) GetValue(prop OutputProperty) (interface{}, error) {
 		return prop.Value.(time.Time), nil
 	case "datastore.GeoPoint":
 		return prop.Value.(datastore.GeoPoint), nil
-	case "[]byte":
+	case TypeBytes:
 		return prop.Value.([]byte), nil
 
 	case "[]interface {}":
@@ -162,34 +239,19 @@ func (ge GeneralEntity) GetString(name string) (string, error) {
 	case float64:
 		return strconv.FormatFloat(v, 'f', -1, 64), nil
 	case *datastore.Key:
-		return v.String(), nil // Assuming Key has a String method to give a meaningful representation
+		return KeyPath(v), nil
 	case time.Time:
 		return v.Format(time.RFC3339), nil
 	case datastore.GeoPoint:
 		return fmt.Sprintf("Lat: %f, Lng: %f", v.Lat, v.Lng), nil
 	case []byte:
-		return string(v), nil // May need to encode to base64 if binary data
-	case *datastore.Entity:
-		return "NOT IMPLEMENTED FOR ENTITY", nil
-		// return fmt.Sprintf("Entity with Kind: %s", v.Key.Kind), nil // Simplistic representation
-	case GeneralEntity:
+		return base64.StdEncoding.EncodeToString(v), nil
+	case *datastore.Entity, GeneralEntity, []interface{}:
 		value, err := stringifyInterface(v)
 		if err != nil {
-			return "", fmt.Errorf("Error in GeneralEntity")
-
-		}
-		return fmt.Sprintf("%s", value), nil
-
-	case []interface{}:
-		var parts []string
-		for _, item := range v {
-			part, err := stringifyInterface(item)
-			if err != nil {
-				return "", fmt.Errorf("error converting array item to string: %s", err)
-			}
-			parts = append(parts, part)
+			return "", fmt.Errorf("error converting %s to string: %s", name, err)
 		}
-		return "[" + strings.Join(parts, ", ") + "]", nil
+		return value, nil
 	case nil:
 		return "NULL", nil
 	default:
@@ -211,7 +273,7 @@ func stringifyInterface(v interface{}) (string, error) {
 		return strconv.FormatFloat(v, 'f', -1, 64), nil
 	case *datastore.Key:
 
-		return v.String(), nil
+		return KeyPath(v), nil
 	case time.Time:
 
 		return v.Format(time.RFC3339), nil
@@ -224,102 +286,109 @@ func stringifyInterface(v interface{}) (string, error) {
 		if v == nil {
 			return "", nil
 		}
-
-		x := "{"
-
-		tmp := GeneralEntity{}
-		tmp.Load(v.Properties)
-
-		for _, prop := range v.Properties {
-			y, err := tmp.GetString(prop.Name)
-			if err != nil {
-				return "", fmt.Errorf("Error in stringify")
-			}
-			x += fmt.Sprintf("%s:%s, ", prop.Name, y)
-
-		}
-		x += "}"
-
-		return x, nil
-
-		if v.Key == nil {
-			return "", nil
-		}
-		return fmt.Sprintf("Entity with Kind: %s", v.Key.Kind), nil
+		nested := GeneralEntity{}
+		nested.Load(v.Properties)
+		return stringifyInterface(nested)
 	case GeneralEntity:
-		x := "{"
-
-		for key, prop := range v {
-			y, err := v.GetString(key)
+		parts := make([]string, 0, len(v))
+		for _, name := range v.Names() {
+			part, err := stringifyInterface(v[name].Value)
 			if err != nil {
-				return "", fmt.Errorf("Error in stringify")
+				return "", err
 			}
-			x += fmt.Sprintf("%s:%s, ", prop.Name, y)
-
+			parts = append(parts, name+":"+part)
 		}
-		x += "}"
-
-		return x, nil
-
+		return "{" + strings.Join(parts, ", ") + "}", nil
 	case nil:
 		return "NULL", nil
 	case []interface{}:
-
-		return "Yee", nil
+		parts := make([]string, len(v))
+		for i, item := range v {
+			part, err := stringifyInterface(item)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = part
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
 	default:
 
 		return "", fmt.Errorf("unsupported type %s in array", reflect.TypeOf(v))
 	}
 }
 
+// GetTableHeaders lists the properties of entities, the key column first and
+// the others by name, each with its dominant type
 func GetTableHeaders(entities []GeneralEntity) []TableHeader {
-
-	headers := make(map[string]TableHeader)
+	headers := make(map[string]*TableHeader)
+	counts := make(map[string]map[string]int)
 
 	for _, e := range entities {
 		for _, x := range e {
-			if _, ok := headers[x.Name]; !ok {
-				headers[x.Name] = TableHeader{
-					Name: x.Name,
-					Type: x.TypeOf,
-				}
-
+			h, ok := headers[x.Name]
+			if !ok {
+				h = &TableHeader{Name: x.Name}
+				headers[x.Name] = h
+				counts[x.Name] = make(map[string]int)
 			}
-
+			if !x.Indexed && x.Name != "key" {
+				h.Unindexed = true
+			}
+			counts[x.Name][x.TypeOf]++
 		}
 	}
-	headerValues := make([]TableHeader, len(headers))
-	i := 0
-	for _, e := range headers {
-		headerValues[i] = e
-		i += 1
 
+	headerValues := make([]TableHeader, 0, len(headers))
+	for name, h := range headers {
+		h.Type = dominantType(counts[name])
+		headerValues = append(headerValues, *h)
 	}
-	sort.Slice(headerValues, func(i, j int) bool {
-		if headerValues[i].Name == "key" {
+	sortHeaders(headerValues)
+	return headerValues
+
+}
+
+// sortHeaders orders headers by name, the key column first
+func sortHeaders(headers []TableHeader) {
+	sort.Slice(headers, func(i, j int) bool {
+		if headers[i].Name == "key" {
 			return true
 
 		}
-		if headerValues[j].Name == "key" {
+		if headers[j].Name == "key" {
 			return false
 		}
-		return headerValues[i].Name < headerValues[j].Name
+		return headers[i].Name < headers[j].Name
 	})
-	return headerValues
+}
 
+// dominantType is the most frequent type, null only when there is no other,
+// ties go to the first type name
+func dominantType(counts map[string]int) string {
+	dominant := TypeNull
+	for t, n := range counts {
+		if t == TypeNull {
+			continue
+		}
+		if dominant == TypeNull || n > counts[dominant] || n == counts[dominant] && t < dominant {
+			dominant = t
+		}
+	}
+	return dominant
 }
 
 // GetAllEntities retrieves entities of a specific kind from Datastore
-func GetAllEntities(ctx context.Context, client *datastore.Client, kind string, sortKey string, sortDirection string, limit int, cursorStr string) ([]GeneralEntity, string, error) {
-	query := datastore.NewQuery(kind).Limit(limit)
-	if sortKey != "" {
-		if sortDirection == "desc" {
-			query = query.Order("-" + sortKey)
-
-		} else {
-			query = query.Order(sortKey)
-		}
+func GetAllEntities(ctx context.Context, client *datastore.Client, q EntityQuery) ([]GeneralEntity, string, error) {
+	query, err := q.Build()
+	if err != nil {
+		return nil, "", err
 	}
+	return RunQuery(ctx, client, query, q.Limit, q.Cursor)
+}
+
+// RunQuery runs a query and returns a page of entities and the cursor of the next page
+func RunQuery(ctx context.Context, client *datastore.Client, query *datastore.Query, limit int, cursorStr string) ([]GeneralEntity, string, error) {
+	query = query.Limit(limit)
 	if cursorStr != "" {
 		cursor, err := datastore.DecodeCursor(cursorStr)
 		if err != nil {
@@ -334,21 +403,20 @@ func GetAllEntities(ctx context.Context, client *datastore.Client, kind string,
 	for {
 		var entity GeneralEntity = make(map[string]OutputProperty)
 		key, err := it.Next(&entity)
-
-		entity["key"] = OutputProperty{
-			Name:    "key",
-			Value:   key.String(),
-			TypeOf:  "string",
-			Indexed: true,
-		}
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			fmt.Println("err", err)
 			return nil, "", err
 		}
 
+		entity["key"] = OutputProperty{
+			Name:    "key",
+			Value:   key,
+			TypeOf:  TypeKey,
+			Indexed: true,
+		}
+
 		entities = append(entities, entity)
 	}
 
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Where KindStats come from
+const (
+	StatsSourceScan     = "scan"
+	StatsSourceStatKind = "__Stat_Kind__"
+)
+
+// maxLargestEntities is how many of the largest entities of a kind are kept
+const maxLargestEntities = 5
+
+// EntitySize is the approximate storage size of an entity
+type EntitySize struct {
+	Key   *datastore.Key
+	Bytes int
+}
+
+// KindStats is the size of a kind, either scanned or read from the built-in statistics
+type KindStats struct {
+	Namespace  string
+	Kind       string
+	Count      int
+	TotalBytes int64
+	Largest    []EntitySize // largest first, only known after a scan
+	Source     string
+	Timestamp  time.Time // when the statistics were computed
+}
+
+func (s KindStats) AverageBytes() int64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalBytes / int64(s.Count)
+}
+
+// statKind is an entity of __Stat_Kind__, or of __Stat_Ns_Kind__ in a namespace
+type statKind struct {
+	KindName  string    `datastore:"kind_name"`
+	Count     int64     `datastore:"count"`
+	Bytes     int64     `datastore:"bytes"`
+	Timestamp time.Time `datastore:"timestamp"`
+}
+
+// GetStatKinds reads the statistics Datastore keeps per kind, about once a day.
+// The emulator keeps none, the map is empty then.
+func GetStatKinds(ctx context.Context, client *datastore.Client, namespace string) (map[string]KindStats, error) {
+	statKindName := "__Stat_Kind__"
+	if namespace != "" {
+		statKindName = "__Stat_Ns_Kind__"
+	}
+	var rows []statKind
+	if _, err := client.GetAll(ctx, datastore.NewQuery(statKindName).Namespace(namespace), &rows); err != nil {
+		return nil, fmt.Errorf("reading %s: %s", statKindName, err)
+	}
+
+	stats := make(map[string]KindStats, len(rows))
+	for _, row := range rows {
+		// Statistics of several days may be kept, use the latest
+		if s, ok := stats[row.KindName]; ok && s.Timestamp.After(row.Timestamp) {
+			continue
+		}
+		stats[row.KindName] = KindStats{
+			Namespace:  namespace,
+			Kind:       row.KindName,
+			Count:      int(row.Count),
+			TotalBytes: row.Bytes,
+			Source:     StatsSourceStatKind,
+			Timestamp:  row.Timestamp,
+		}
+	}
+	return stats, nil
+}
+
+// ScanKind counts the entities of kind with a keys-only query, then reads them
+// all to add up their sizes. progress is called with the entities read so far
+// and the count.
+func ScanKind(ctx context.Context, client *datastore.Client, namespace string, kind string, progress func(done int, total int)) (KindStats, error) {
+	stats := KindStats{Namespace: namespace, Kind: kind, Source: StatsSourceScan}
+
+	total, err := client.Count(ctx, datastore.NewQuery(kind).Namespace(namespace).KeysOnly())
+	if err != nil {
+		return stats, err
+	}
+	progress(0, total)
+
+	query := datastore.NewQuery(kind).Namespace(namespace)
+	_, err = EachEntity(ctx, client, query, 0, 0, func(e GeneralEntity) error {
+		size := EntitySize{Key: e.Key(), Bytes: entitySize(e)}
+		stats.Count++
+		stats.TotalBytes += int64(size.Bytes)
+		stats.Largest = addLargest(stats.Largest, size)
+		if stats.Count%exportPageSize == 0 {
+			progress(stats.Count, max(total, stats.Count))
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	progress(stats.Count, stats.Count)
+	stats.Timestamp = time.Now()
+	return stats, nil
+}
+
+func addLargest(largest []EntitySize, size EntitySize) []EntitySize {
+	if len(largest) == maxLargestEntities && size.Bytes <= largest[len(largest)-1].Bytes {
+		return largest
+	}
+	i := sort.Search(len(largest), func(i int) bool { return largest[i].Bytes < size.Bytes })
+	largest = append(largest[:i], append([]EntitySize{size}, largest[i:]...)...)
+	return largest[:min(len(largest), maxLargestEntities)]
+}
+
+// entitySize approximates the stored size of an entity following the storage
+// size calculations Datastore documents: key, property names and values
+func entitySize(e GeneralEntity) int {
+	size := keySize(e.Key()) + 16
+	for name, prop := range e {
+		if name == "key" {
+			continue
+		}
+		size += len(name) + 1 + valueSize(prop.Value)
+	}
+	return size
+}
+
+func keySize(key *datastore.Key) int {
+	if key == nil {
+		return 0
+	}
+	// The project id is stored too but the same for every key, it is left out
+	size := len(key.Namespace) + 1
+	for k := key; k != nil; k = k.Parent {
+		size += len(k.Kind) + 1
+		if k.Name != "" {
+			size += len(k.Name) + 1
+		} else {
+			size += 8
+		}
+	}
+	return size
+}
+
+func valueSize(v interface{}) int {
+	switch v := v.(type) {
+	case nil, bool:
+		return 1
+	case int64, float64, time.Time:
+		return 8
+	case datastore.GeoPoint:
+		return 16
+	case string:
+		return len(v) + 1
+	case []byte:
+		return len(v) + 1
+	case *datastore.Key:
+		return keySize(v)
+	case GeneralEntity:
+		size := 0
+		for name, prop := range v {
+			size += len(name) + 1 + valueSize(prop.Value)
+		}
+		return size
+	case *datastore.Entity:
+		size := 0
+		for _, prop := range v.Properties {
+			size += len(prop.Name) + 1 + valueSize(prop.Value)
+		}
+		return size
+	case []interface{}:
+		size := 0
+		for _, item := range v {
+			size += valueSize(item)
+		}
+		return size
+	default:
+		return len(fmt.Sprint(v))
+	}
+}
+
+// IsStatKind tells whether kind is one of the built-in statistics kinds
+func IsStatKind(kind string) bool {
+	return strings.HasPrefix(kind, "__")
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// maxTreeNodes is how many keys are listed per level of the tree
+const maxTreeNodes = 100
+
+// maxTreeDescendants is how many descendants are read to count the children of a key
+const maxTreeDescendants = 10000
+
+// ChildKind groups the direct children of a key that have kind Kind
+type ChildKind struct {
+	Kind  string
+	Count int
+	Keys  []*datastore.Key // the first children, up to maxTreeNodes
+}
+
+// TreeChildren are the direct children of a key grouped by kind
+type TreeChildren struct {
+	Kinds       []ChildKind
+	Descendants int  // at any depth
+	Truncated   bool // there are more than maxTreeDescendants descendants, counts are partial
+}
+
+// RootKeys lists up to maxTreeNodes keys of kind without parent, and the cursor
+// just after the last one when the kind may have more. Keys with a parent are
+// skipped, reading on until enough roots are found or the kind runs out.
+func RootKeys(ctx context.Context, client *datastore.Client, namespace string, kind string, cursor string) ([]*datastore.Key, string, error) {
+	query := datastore.NewQuery(kind).Namespace(namespace).KeysOnly()
+	if cursor != "" {
+		c, err := datastore.DecodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Start(c)
+	}
+
+	var roots []*datastore.Key
+	it := client.Run(ctx, query)
+	for {
+		key, err := it.Next(nil)
+		if err == iterator.Done {
+			return roots, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if key.Parent != nil {
+			continue
+		}
+		roots = append(roots, key)
+		if len(roots) == maxTreeNodes {
+			break
+		}
+	}
+	next, err := it.Cursor()
+	if err != nil {
+		return nil, "", err
+	}
+	return roots, next.String(), nil
+}
+
+// Children finds the children of key with a kindless ancestor query
+func Children(ctx context.Context, client *datastore.Client, key *datastore.Key) (*TreeChildren, error) {
+	query := datastore.NewQuery("").Namespace(key.Namespace).Ancestor(key).KeysOnly().Limit(maxTreeDescendants + 1)
+	keys, err := client.GetAll(ctx, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	children := &TreeChildren{}
+	kinds := map[string]*ChildKind{}
+	for _, k := range keys {
+		// The ancestor itself is one of the results
+		if k.Equal(key) {
+			continue
+		}
+		if children.Descendants == maxTreeDescendants {
+			children.Truncated = true
+			break
+		}
+		children.Descendants++
+		if !k.Parent.Equal(key) {
+			continue
+		}
+		child, ok := kinds[k.Kind]
+		if !ok {
+			child = &ChildKind{Kind: k.Kind}
+			kinds[k.Kind] = child
+		}
+		child.Count++
+		if len(child.Keys) < maxTreeNodes {
+			child.Keys = append(child.Keys, k)
+		}
+	}
+
+	for _, child := range kinds {
+		children.Kinds = append(children.Kinds, *child)
+	}
+	sort.Slice(children.Kinds, func(i, j int) bool { return children.Kinds[i].Kind < children.Kinds[j].Kind })
+	return children, nil
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Type names as reported by OutputProperty.TypeOf
+const (
+	TypeInt64    = "int64"
+	TypeFloat64  = "float64"
+	TypeBool     = "bool"
+	TypeString   = "string"
+	TypeTime     = "time.Time"
+	TypeGeoPoint = "datastore.GeoPoint"
+	TypeBytes    = "[]uint8"
+	TypeKey      = "*datastore.Key"
+	TypeEntity   = "service.GeneralEntity"
+	TypeArray    = "[]interface {}"
+	TypeNull     = "<nil>"
+)
+
+// ScalarTypes lists the types that have a text form
+var ScalarTypes = []string{
+	TypeString,
+	TypeInt64,
+	TypeFloat64,
+	TypeBool,
+	TypeTime,
+	TypeGeoPoint,
+	TypeBytes,
+	TypeKey,
+}
+
+// PropertyTypes lists every type a property can be edited as
+var PropertyTypes = append(ScalarTypes[:len(ScalarTypes):len(ScalarTypes)], TypeEntity, TypeArray, TypeNull)
+
+// ParsePropertyValue converts the text form of a scalar value back into its Datastore type
+func ParsePropertyValue(typeOf string, raw string) (interface{}, error) {
+	switch typeOf {
+	case TypeInt64:
+		v, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int64 %q", raw)
+		}
+		return v, nil
+	case TypeFloat64:
+		v, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float64 %q", raw)
+		}
+		return v, nil
+	case TypeBool:
+		v, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool %q", raw)
+		}
+		return v, nil
+	case TypeString:
+		return raw, nil
+	case TypeTime:
+		return parseTime(strings.TrimSpace(raw))
+	case TypeGeoPoint:
+		lat, lng, ok := strings.Cut(raw, ",")
+		if !ok {
+			return nil, fmt.Errorf("invalid GeoPoint %q, expected lat,lng", raw)
+		}
+		p := datastore.GeoPoint{}
+		var err error
+		if p.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil {
+			return nil, fmt.Errorf("invalid latitude %q", lat)
+		}
+		if p.Lng, err = strconv.ParseFloat(strings.TrimSpace(lng), 64); err != nil {
+			return nil, fmt.Errorf("invalid longitude %q", lng)
+		}
+		if !p.Valid() {
+			return nil, fmt.Errorf("GeoPoint %q out of range", raw)
+		}
+		return p, nil
+	case TypeBytes:
+		v, err := base64.StdEncoding.DecodeString(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 blob: %s", err)
+		}
+		return v, nil
+	case TypeKey:
+		k, err := datastore.DecodeKey(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid encoded key %q", raw)
+		}
+		return k, nil
+	case TypeNull:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("type %s has no scalar form", typeOf)
+	}
+}
+
+// FormatPropertyValue is the inverse of ParsePropertyValue
+func FormatPropertyValue(v interface{}) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case *datastore.Key:
+		if v == nil {
+			return ""
+		}
+		return v.Encode()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case datastore.GeoPoint:
+		return strconv.FormatFloat(v.Lat, 'g', -1, 64) + "," + strconv.FormatFloat(v.Lng, 'g', -1, 64)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	default:
+		return ""
+	}
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func parseTime(raw string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339", raw)
+}
@@ -0,0 +1,321 @@
+package tui
+
+import (
+	"backend/service"
+	"backend/viewmodel"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// ANSI styles, applied after the text is cut to its column width
+const (
+	styleReset     = "\x1b[0m"
+	styleBold      = "\x1b[1m"
+	styleDim       = "\x1b[2m"
+	styleUnderline = "\x1b[4m"
+	styleReverse   = "\x1b[7m"
+	styleRed       = "\x1b[31m"
+	styleGreen     = "\x1b[32m"
+)
+
+const (
+	kindsWidth  = 24
+	maxColWidth = 32
+	separator   = " │ "
+)
+
+// detailLine is one property, or array element, of the detail pane
+type detailLine struct {
+	depth     int
+	label     string
+	typeName  string
+	indexed   bool
+	value     string // as shown
+	copyValue string // as copied, JSON for entities and arrays
+}
+
+// typeLabel is the type column of the line, which also marks unindexed values
+func (l detailLine) typeLabel() string {
+	if !l.indexed {
+		return l.typeName + ", unindexed"
+	}
+	return l.typeName
+}
+
+// flattenFields lists fields and their nested fields depth first
+func flattenFields(fields []viewmodel.PropertyField, depth int) []detailLine {
+	var lines []detailLine
+	for i, f := range fields {
+		label := f.Name
+		if label == "" {
+			label = fmt.Sprintf("[%d]", i)
+		}
+		line := detailLine{depth: depth, label: label, typeName: f.Type, indexed: f.Indexed, value: f.Value, copyValue: f.Value}
+		switch f.Type {
+		case service.TypeGeoPoint:
+			line.value = f.Lat + "," + f.Lng
+			line.copyValue = line.value
+		case service.TypeEntity, service.TypeArray:
+			line.value = fmt.Sprintf("%d items", len(f.Fields))
+			line.copyValue = f.JSON
+		}
+		lines = append(lines, line)
+		lines = append(lines, flattenFields(f.Fields, depth+1)...)
+	}
+	return lines
+}
+
+// printable keeps values on one line and control bytes, as in raw blobs, off the terminal
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n':
+			return '⏎'
+		case r == '\t':
+			return ' '
+		case !unicode.IsPrint(r):
+			return '·'
+		}
+		return r
+	}, s)
+}
+
+// fit cuts s to width cells and pads it to exactly width
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	s = runewidth.Truncate(printable(s), width, "…")
+	return runewidth.FillRight(s, width)
+}
+
+func styled(s string, styles ...string) string {
+	return strings.Join(styles, "") + s + styleReset
+}
+
+func (m *model) View() string {
+	if m.width == 0 {
+		return "Loading…"
+	}
+	bodyHeight := max(m.height-3, 1)
+
+	var b strings.Builder
+	b.WriteString(styled(fit(m.title(), m.width), styleBold, styleReverse))
+	b.WriteString("\n")
+
+	kinds := m.kindLines(bodyHeight)
+	var right []string
+	rightWidth := max(m.width-kindsWidth-runewidth.StringWidth(separator), 0)
+	if m.detail != nil {
+		right = m.detailLines(rightWidth, bodyHeight)
+	} else {
+		right = m.tableLines(rightWidth, bodyHeight)
+	}
+	for i := 0; i < bodyHeight; i++ {
+		b.WriteString(kinds[i])
+		b.WriteString(styled(separator, styleDim))
+		if i < len(right) {
+			b.WriteString(right[i])
+		}
+		b.WriteString("\n")
+	}
+
+	switch {
+	case m.table.Error != "":
+		b.WriteString(styled(fit(m.table.Error, m.width), styleRed))
+	case m.table.Message != "":
+		b.WriteString(styled(fit(m.table.Message, m.width), styleGreen))
+	default:
+		b.WriteString(fit(m.status, m.width))
+	}
+	b.WriteString("\n")
+	b.WriteString(styled(fit(m.help(), m.width), styleDim))
+	return b.String()
+}
+
+func (m *model) title() string {
+	namespace := m.table.Namespace
+	if namespace == "" {
+		namespace = "(default)"
+	}
+	title := " Datastore  namespace: " + namespace
+	if m.table.Selected != "" {
+		title += fmt.Sprintf("  kind: %s  page %d of %d",
+			m.table.Selected, m.table.PageOffset+m.table.CurrentPage, m.table.PageOffset+m.table.Pages)
+		if m.table.HasNextPage {
+			title += "+"
+		}
+	}
+	if len(m.table.Sorts) > 0 {
+		orders := make([]string, len(m.table.Sorts))
+		for i, o := range m.table.Sorts {
+			orders[i] = o.Property + " " + o.Direction
+		}
+		title += "  sorted by " + strings.Join(orders, ", ")
+	}
+	return title
+}
+
+func (m *model) help() string {
+	switch m.focus {
+	case focusKinds:
+		return " ↑↓ kind  enter open  n namespace  tab table  q quit"
+	case focusTable:
+		return " ↑↓←→ move  s sort  S add sort  [ ] page  enter detail  y copy cell  Y copy key  r refresh  tab kinds  q quit"
+	default:
+		return " ↑↓ move  y copy value  Y copy key  esc back  q quit"
+	}
+}
+
+// kindLines renders the kind list, exactly height lines of kindsWidth cells
+func (m *model) kindLines(height int) []string {
+	lines := make([]string, height)
+	offset := max(m.kind-height+1, 0)
+	for i := range lines {
+		k := offset + i
+		if k >= len(m.table.Kinds) {
+			lines[i] = fit("", kindsWidth)
+			continue
+		}
+		text := fit(" "+m.table.Kinds[k], kindsWidth)
+		switch {
+		case k == m.kind && m.focus == focusKinds:
+			lines[i] = styled(text, styleReverse)
+		case m.table.Kinds[k] == m.table.Selected:
+			lines[i] = styled(text, styleBold)
+		default:
+			lines[i] = text
+		}
+	}
+	return lines
+}
+
+// tableLines renders the header and the rows of the current page that fit,
+// scrolled so the cursor stays visible
+func (m *model) tableLines(width int, height int) []string {
+	if m.table.Selected == "" {
+		return []string{fit("Select a kind", width)}
+	}
+	headers := m.table.Headers
+	if len(m.table.View) == 0 {
+		return []string{fit("No entities", width)}
+	}
+
+	cells := make([][]string, len(m.table.View))
+	widths := make([]int, len(headers))
+	for c, h := range headers {
+		widths[c] = runewidth.StringWidth(h.Name) + 2
+	}
+	for r, e := range m.table.View {
+		cells[r] = make([]string, len(headers))
+		for c, h := range headers {
+			value, err := e.GetString(h.Name)
+			if err != nil {
+				value = "error: " + err.Error()
+			}
+			cells[r][c] = value
+			widths[c] = max(widths[c], runewidth.StringWidth(printable(value)))
+		}
+	}
+	for c := range widths {
+		widths[c] = min(widths[c], maxColWidth)
+	}
+
+	// Scroll right until the column under the cursor fits
+	first := 0
+	for first < m.col && columnsWidth(widths[first:m.col+1]) > width {
+		first++
+	}
+
+	header := make([]string, 0, len(headers))
+	for c := first; c < len(headers); c++ {
+		name := headers[c].Name
+		if order, direction := m.table.SortOrder(name); order > 0 {
+			if direction == viewmodel.SortDesc {
+				name += " ↓"
+			} else {
+				name += " ↑"
+			}
+			if len(m.table.Sorts) > 1 {
+				name += strconv.Itoa(order)
+			}
+		}
+		header = append(header, styled(fit(name, widths[c]), styleBold, styleUnderline))
+	}
+	lines := []string{joinColumns(header, widths[first:], width)}
+
+	offset := max(m.row-(height-1)+1, 0)
+	for r := offset; r < len(cells) && len(lines) < height; r++ {
+		row := make([]string, 0, len(headers))
+		for c := first; c < len(headers); c++ {
+			text := fit(cells[r][c], widths[c])
+			switch {
+			case r == m.row && c == m.col && m.focus == focusTable:
+				text = styled(text, styleReverse, styleBold)
+			case r == m.row:
+				text = styled(text, styleReverse)
+			}
+			row = append(row, text)
+		}
+		lines = append(lines, joinColumns(row, widths[first:], width))
+	}
+	return lines
+}
+
+func columnsWidth(widths []int) int {
+	total := 0
+	for _, w := range widths {
+		total += w + 2
+	}
+	return total
+}
+
+// joinColumns joins the styled columns that fit in width, the last one is left out
+// when it does not fit completely
+func joinColumns(columns []string, widths []int, width int) string {
+	var b strings.Builder
+	used := 0
+	for i, column := range columns {
+		if used+widths[i] > width {
+			break
+		}
+		b.WriteString(column)
+		used += widths[i]
+		if used+2 <= width {
+			b.WriteString("  ")
+			used += 2
+		}
+	}
+	return b.String()
+}
+
+// detailLines renders the properties of the open entity
+func (m *model) detailLines(width int, height int) []string {
+	lines := []string{styled(fit(service.KeyPath(m.detail.Key), width), styleBold)}
+
+	labelWidth, typeWidth := 0, 0
+	for _, l := range m.lines {
+		labelWidth = max(labelWidth, 2*l.depth+runewidth.StringWidth(l.label))
+		typeWidth = max(typeWidth, runewidth.StringWidth(l.typeLabel()))
+	}
+	labelWidth = min(labelWidth, maxColWidth)
+	typeWidth = min(typeWidth, maxColWidth)
+	valueWidth := max(width-labelWidth-typeWidth-4, 0)
+
+	offset := max(m.line-(height-1)+1, 0)
+	for i := offset; i < len(m.lines) && len(lines) < height; i++ {
+		l := m.lines[i]
+		text := fit(strings.Repeat("  ", l.depth)+l.label, labelWidth) + "  " +
+			styled(fit(l.typeLabel(), typeWidth), styleDim) + "  " +
+			fit(l.value, valueWidth)
+		if i == m.line {
+			text = styleReverse + strings.ReplaceAll(text, styleReset, styleReset+styleReverse) + styleReset
+		}
+		lines = append(lines, text)
+	}
+	return lines
+}
@@ -0,0 +1,301 @@
+// Package tui is a terminal front-end for the same view models the web UI uses
+package tui
+
+import (
+	"backend/service"
+	"backend/viewmodel"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"cloud.google.com/go/datastore"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Run shows the terminal UI until the user quits. Logs go to debug.log when
+// DEBUG is set, they would garble the screen otherwise.
+func Run(ctx context.Context, client *datastore.Client) error {
+	if os.Getenv("DEBUG") != "" {
+		f, err := tea.LogToFile("debug.log", "tui")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+	} else {
+		log.SetOutput(io.Discard)
+	}
+
+	m := &model{
+		ctx:    ctx,
+		client: client,
+		table:  viewmodel.NewTableViewModel(client),
+	}
+
+	_, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx)).Run()
+	return err
+}
+
+type focus int
+
+const (
+	focusKinds focus = iota
+	focusTable
+	focusDetail
+)
+
+type model struct {
+	ctx    context.Context
+	client *datastore.Client
+	table  *viewmodel.TableViewModel
+	detail *viewmodel.EntityViewModel
+	lines  []detailLine // flattened fields of detail
+
+	focus   focus
+	kind    int  // cursor in the kind list
+	row     int  // cursor in the current page
+	col     int  // cursor in the headers
+	line    int  // cursor in the detail lines
+	loading bool // a fetch is running, keys other than quit wait for it
+	status  string
+
+	width  int
+	height int
+}
+
+// tableMsg is the table after a fetch, see apply
+type tableMsg struct {
+	table *viewmodel.TableViewModel
+	err   error
+}
+
+// detailMsg is the entity opened by openDetail
+type detailMsg struct {
+	detail *viewmodel.EntityViewModel
+	err    error
+}
+
+func (m *model) Init() tea.Cmd {
+	return m.apply(viewmodel.TableState{Page: 1})
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tableMsg:
+		m.loading, m.status = false, ""
+		m.table = msg.table
+		if msg.err != nil {
+			m.table.Error = msg.err.Error()
+		}
+		m.row = clamp(m.row, len(m.table.View))
+		m.col = clamp(m.col, len(m.table.Headers))
+	case detailMsg:
+		m.loading, m.status = false, ""
+		if msg.err != nil {
+			m.table.Error = msg.err.Error()
+			break
+		}
+		m.detail = msg.detail
+		m.lines = flattenFields(msg.detail.Fields, 0)
+		m.line = 0
+		m.focus = focusDetail
+	case tea.KeyMsg:
+		if key := msg.String(); key == "ctrl+c" || key == "q" {
+			return m, tea.Quit
+		}
+		if m.loading {
+			return m, nil
+		}
+		m.status = ""
+		m.table.ClearMessages()
+		switch msg.String() {
+		case "tab":
+			m.toggleFocus()
+		case "n":
+			return m, m.nextNamespace()
+		case "r":
+			m.table.Refresh()
+			return m, m.apply(m.table.State())
+		default:
+			switch m.focus {
+			case focusKinds:
+				return m, m.updateKinds(msg.String())
+			case focusTable:
+				return m, m.updateTable(msg.String())
+			case focusDetail:
+				m.updateDetail(msg.String())
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *model) updateKinds(key string) tea.Cmd {
+	switch key {
+	case "up", "k":
+		m.kind = clamp(m.kind-1, len(m.table.Kinds))
+	case "down", "j":
+		m.kind = clamp(m.kind+1, len(m.table.Kinds))
+	case "enter", "right", "l":
+		if m.kind < len(m.table.Kinds) {
+			m.row, m.col = 0, 0
+			m.focus = focusTable
+			return m.apply(m.table.State().WithKind(m.table.Kinds[m.kind]))
+		}
+	}
+	return nil
+}
+
+func (m *model) updateTable(key string) tea.Cmd {
+	switch key {
+	case "up", "k":
+		m.row = clamp(m.row-1, len(m.table.View))
+	case "down", "j":
+		m.row = clamp(m.row+1, len(m.table.View))
+	case "left", "h":
+		m.col = clamp(m.col-1, len(m.table.Headers))
+	case "right", "l":
+		m.col = clamp(m.col+1, len(m.table.Headers))
+	case "home", "g":
+		m.row = 0
+	case "end", "G":
+		m.row = clamp(len(m.table.View)-1, len(m.table.View))
+	case "pgdown", "]":
+		if m.table.HasNextPage {
+			m.row = 0
+			return m.apply(m.table.NextState())
+		}
+	case "pgup", "[":
+		if m.table.HasPrevPage {
+			m.row = 0
+			return m.apply(m.table.PrevState())
+		}
+	case "s":
+		if m.col < len(m.table.Headers) {
+			m.row = 0
+			return m.apply(m.table.SortState(m.table.Headers[m.col].Name))
+		}
+	case "S":
+		if m.col < len(m.table.Headers) {
+			m.row = 0
+			return m.apply(m.table.AddSortState(m.table.Headers[m.col].Name))
+		}
+	case "y":
+		if e := m.entity(); e != nil && m.col < len(m.table.Headers) {
+			name := m.table.Headers[m.col].Name
+			value, err := e.GetString(name)
+			m.copy(name, value, err)
+		}
+	case "Y":
+		if e := m.entity(); e != nil {
+			m.copy("key", e.Key().Encode(), nil)
+		}
+	case "enter":
+		if e := m.entity(); e != nil {
+			return m.openDetail(e.Key())
+		}
+	}
+	return nil
+}
+
+func (m *model) updateDetail(key string) {
+	switch key {
+	case "up", "k":
+		m.line = clamp(m.line-1, len(m.lines))
+	case "down", "j":
+		m.line = clamp(m.line+1, len(m.lines))
+	case "esc", "backspace", "left", "h":
+		m.focus = focusTable
+		m.detail = nil
+	case "y":
+		if m.line < len(m.lines) {
+			l := m.lines[m.line]
+			m.copy(l.label, l.copyValue, nil)
+		}
+	case "Y":
+		m.copy("key", m.detail.Key.Encode(), nil)
+	}
+}
+
+func (m *model) toggleFocus() {
+	switch m.focus {
+	case focusKinds:
+		if m.table.Selected != "" {
+			m.focus = focusTable
+		}
+	default:
+		m.focus = focusKinds
+		m.detail = nil
+	}
+}
+
+// nextNamespace switches to the namespace after the current one, kinds differ per namespace
+func (m *model) nextNamespace() tea.Cmd {
+	namespaces := m.table.Namespaces
+	if len(namespaces) == 0 {
+		return nil
+	}
+	next := namespaces[0]
+	for i, ns := range namespaces {
+		if ns == m.table.Namespace {
+			next = namespaces[(i+1)%len(namespaces)]
+		}
+	}
+	m.kind, m.row, m.col = 0, 0, 0
+	m.focus = focusKinds
+	m.detail = nil
+	return m.apply(viewmodel.TableState{Namespace: next, Page: 1})
+}
+
+// apply makes the table show state. The fetch runs on a copy of the table off
+// the Update loop, so a slow emulator does not freeze the screen, and tableMsg
+// swaps the copy in. Errors are shown in the status line.
+func (m *model) apply(state viewmodel.TableState) tea.Cmd {
+	m.loading, m.status = true, "Loading…"
+	ctx, table := m.ctx, *m.table
+	return func() tea.Msg {
+		err := table.Apply(ctx, state)
+		return tableMsg{table: &table, err: err}
+	}
+}
+
+// entity is the entity under the cursor
+func (m *model) entity() service.GeneralEntity {
+	if m.row >= len(m.table.View) {
+		return nil
+	}
+	return m.table.View[m.row]
+}
+
+// openDetail loads the entity of key off the Update loop, detailMsg shows it
+func (m *model) openDetail(key *datastore.Key) tea.Cmd {
+	m.loading, m.status = true, "Loading…"
+	ctx, client := m.ctx, m.client
+	return func() tea.Msg {
+		evm := viewmodel.NewEntityViewModel(client)
+		err := evm.Load(ctx, key.Encode())
+		return detailMsg{detail: evm, err: err}
+	}
+}
+
+// copy puts value in the clipboard with an OSC 52 escape sequence, which
+// terminals forward to the local clipboard even over SSH
+func (m *model) copy(name string, value string, err error) {
+	if err == nil {
+		_, err = fmt.Fprintf(os.Stderr, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+	if err != nil {
+		m.table.Error = fmt.Sprintf("copy %s: %s", name, err)
+		return
+	}
+	m.status = "Copied " + name
+}
+
+// clamp keeps a cursor within a list of n items, at 0 when the list is empty
+func clamp(i int, n int) int {
+	return max(min(i, n-1), 0)
+}
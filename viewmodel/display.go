@@ -0,0 +1,47 @@
+package viewmodel
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timezones offered for showing times, any other IANA name works too
+var Timezones = []string{
+	"UTC",
+	"Local",
+	"America/Los_Angeles",
+	"America/New_York",
+	"America/Sao_Paulo",
+	"Europe/London",
+	"Europe/Berlin",
+	"Africa/Johannesburg",
+	"Asia/Kolkata",
+	"Asia/Singapore",
+	"Asia/Tokyo",
+	"Australia/Sydney",
+}
+
+// Display is how values are formatted, shared by the tables of a session
+type Display struct {
+	Timezone string
+	location *time.Location
+}
+
+func NewDisplay() *Display {
+	return &Display{Timezone: "UTC", location: time.UTC}
+}
+
+// SetTimezone shows times in the named IANA timezone
+func (d *Display) SetTimezone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q", name)
+	}
+	d.Timezone = name
+	d.location = loc
+	return nil
+}
+
+func (d *Display) Location() *time.Location {
+	return d.location
+}
@@ -0,0 +1,353 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// RootPath prefixes the form field names of top level properties
+const RootPath = "p"
+
+// PropertyField is the editable form of a property, or of an array element when Name is empty
+type PropertyField struct {
+	Path    string
+	Name    string
+	Type    string
+	Value   string
+	Lat     string
+	Lng     string
+	Indexed bool            // array elements follow the array, Datastore indexes all of them or none
+	Missing bool            // a key without entity
+	JSON    string          // plain JSON of a loaded nested entity or array
+	Fields  []PropertyField // nested entity properties or array elements
+}
+
+// Key modes of a new entity
+const (
+	KeyModeIncomplete = "incomplete"
+	KeyModeName       = "name"
+	KeyModeID         = "id"
+)
+
+type EntityViewModel struct {
+	client    *datastore.Client
+	Key       *datastore.Key // nil until a new entity is created
+	Namespace string
+	Kind      string
+	KeyMode   string
+	KeyName   string // name or numeric ID of a new entity, depending on KeyMode
+	Parent    string // encoded parent key of a new entity
+	Fields    []PropertyField
+	Stats     *StatsCache // forgets the kind of saved entities, may be nil
+	Error     string
+	Message   string
+}
+
+func NewEntityViewModel(c *datastore.Client) *EntityViewModel {
+	return &EntityViewModel{
+		client: c,
+	}
+}
+
+func (vm *EntityViewModel) Load(ctx context.Context, encodedKey string) error {
+	key, err := datastore.DecodeKey(encodedKey)
+	if err != nil {
+		return fmt.Errorf("invalid key %q", encodedKey)
+	}
+	entity, err := service.GetEntity(ctx, vm.client, key)
+	if err != nil {
+		return err
+	}
+	missing, err := service.MissingKeys(ctx, vm.client, service.ReferencedKeys([]service.GeneralEntity{entity}))
+	if err != nil {
+		return err
+	}
+	vm.Key = key
+	vm.Namespace = key.Namespace
+	vm.Kind = key.Kind
+	vm.Fields = fieldsFromEntity(RootPath, entity)
+	markMissing(vm.Fields, missing)
+	return nil
+}
+
+// markMissing flags the key fields whose entity does not exist
+func markMissing(fields []PropertyField, missing map[string]bool) {
+	for i := range fields {
+		fields[i].Missing = fields[i].Type == service.TypeKey && missing[fields[i].Value]
+		markMissing(fields[i].Fields, missing)
+	}
+}
+
+func (vm *EntityViewModel) IsNew() bool {
+	return vm.Key == nil
+}
+
+// Update applies a submitted form. The action field decides whether a field is
+// added ("add:<path>"), removed ("remove:<path>") or the entity is written ("save").
+func (vm *EntityViewModel) Update(ctx context.Context, form url.Values) error {
+	if kind := form.Get("kind"); kind != "" {
+		vm.Namespace = form.Get("namespace")
+		vm.Kind = kind
+		vm.KeyMode = form.Get("keyMode")
+		vm.KeyName = form.Get("keyName")
+		vm.Parent = form.Get("parent")
+	} else {
+		key, err := datastore.DecodeKey(form.Get("key"))
+		if err != nil {
+			return fmt.Errorf("invalid key %q", form.Get("key"))
+		}
+		vm.Key = key
+		vm.Namespace = key.Namespace
+		vm.Kind = key.Kind
+	}
+	vm.Fields = fieldsFromForm(form, RootPath)
+
+	action := form.Get("action")
+	switch {
+	case strings.HasPrefix(action, "add:"):
+		vm.Fields = addField(vm.Fields, RootPath, strings.TrimPrefix(action, "add:"))
+	case strings.HasPrefix(action, "remove:"):
+		vm.Fields = removeField(vm.Fields, strings.TrimPrefix(action, "remove:"))
+	case action == "save":
+		return vm.save(ctx)
+	}
+	renumberFields(vm.Fields, RootPath)
+	return nil
+}
+
+func (vm *EntityViewModel) save(ctx context.Context) error {
+	entity, err := entityFromFields(vm.Fields)
+	if err != nil {
+		vm.Error = err.Error()
+		return nil
+	}
+	key := vm.Key
+	message := "Saved"
+	if vm.IsNew() {
+		if key, err = vm.newKey(); err != nil {
+			vm.Error = err.Error()
+			return nil
+		}
+		message = "Created"
+	}
+	key, err = service.PutEntity(ctx, vm.client, key, entity)
+	if err != nil {
+		vm.Error = err.Error()
+		return nil
+	}
+	vm.Stats.Forget(key.Namespace, key.Kind)
+	if err := vm.Load(ctx, key.Encode()); err != nil {
+		return err
+	}
+	vm.Message = message
+	return nil
+}
+
+func (vm *EntityViewModel) newKey() (*datastore.Key, error) {
+	var parent *datastore.Key
+	if vm.Parent != "" {
+		var err error
+		if parent, err = datastore.DecodeKey(vm.Parent); err != nil {
+			return nil, fmt.Errorf("invalid parent key %q", vm.Parent)
+		}
+		if parent.Namespace != vm.Namespace {
+			return nil, fmt.Errorf("parent key is in namespace %q, not %q", parent.Namespace, vm.Namespace)
+		}
+	}
+
+	var key *datastore.Key
+	switch vm.KeyMode {
+	case KeyModeName:
+		if vm.KeyName == "" {
+			return nil, fmt.Errorf("key name is required")
+		}
+		key = datastore.NameKey(vm.Kind, vm.KeyName, parent)
+	case KeyModeID:
+		id, err := strconv.ParseInt(vm.KeyName, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid key ID %q", vm.KeyName)
+		}
+		key = datastore.IDKey(vm.Kind, id, parent)
+	default:
+		key = datastore.IncompleteKey(vm.Kind, parent)
+	}
+	key.Namespace = vm.Namespace
+	return key, nil
+}
+
+func fieldsFromEntity(prefix string, entity service.GeneralEntity) []PropertyField {
+	names := make([]string, 0, len(entity))
+	for name := range entity {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]PropertyField, len(names))
+	for i, name := range names {
+		prop := entity[name]
+		fields[i] = fieldFromValue(fmt.Sprintf("%s.%d", prefix, i), name, prop.Value, prop.Indexed)
+	}
+	return fields
+}
+
+func fieldFromValue(path string, name string, value interface{}, indexed bool) PropertyField {
+	// Load only converts nested entities at the top level, array elements stay raw
+	if e, ok := value.(*datastore.Entity); ok && e != nil {
+		nested := service.GeneralEntity{}
+		nested.Load(e.Properties)
+		value = nested
+	}
+
+	f := PropertyField{
+		Path:    path,
+		Name:    name,
+		Type:    fmt.Sprintf("%T", value),
+		Indexed: indexed,
+	}
+	switch v := value.(type) {
+	case service.GeneralEntity:
+		f.Fields = fieldsFromEntity(path, v)
+		f.JSON = service.ValueJSON(v)
+	case []interface{}:
+		for i, item := range v {
+			f.Fields = append(f.Fields, fieldFromValue(fmt.Sprintf("%s.%d", path, i), "", item, indexed))
+		}
+		f.JSON = service.ValueJSON(v)
+	case datastore.GeoPoint:
+		f.Lat, f.Lng, _ = strings.Cut(service.FormatPropertyValue(v), ",")
+	default:
+		f.Value = service.FormatPropertyValue(v)
+	}
+	return f
+}
+
+// blankField keeps the name, type and nested structure of a field but drops its values
+func blankField(f PropertyField) PropertyField {
+	f.Value = ""
+	f.Lat = ""
+	f.Lng = ""
+	switch f.Type {
+	case service.TypeInt64, service.TypeFloat64:
+		f.Value = "0"
+	case service.TypeBool:
+		f.Value = "false"
+	case service.TypeGeoPoint:
+		f.Lat = "0"
+		f.Lng = "0"
+	case service.TypeArray:
+		f.Fields = nil
+	}
+	for i := range f.Fields {
+		f.Fields[i] = blankField(f.Fields[i])
+	}
+	return f
+}
+
+func fieldsFromForm(form url.Values, prefix string) []PropertyField {
+	var fields []PropertyField
+	for i := 0; ; i++ {
+		path := fmt.Sprintf("%s.%d", prefix, i)
+		if _, ok := form[path+".type"]; !ok {
+			return fields
+		}
+		f := PropertyField{
+			Path:    path,
+			Name:    form.Get(path + ".name"),
+			Type:    form.Get(path + ".type"),
+			Value:   form.Get(path + ".value"),
+			Lat:     form.Get(path + ".lat"),
+			Lng:     form.Get(path + ".lng"),
+			Indexed: form.Get(path+".indexed") != "",
+		}
+		if f.Type == service.TypeEntity || f.Type == service.TypeArray {
+			f.Fields = fieldsFromForm(form, path)
+		}
+		if f.Type == service.TypeArray {
+			// Elements have no checkbox of their own
+			for i := range f.Fields {
+				f.Fields[i].Indexed = f.Indexed
+			}
+		}
+		fields = append(fields, f)
+	}
+}
+
+func addField(fields []PropertyField, prefix string, target string) []PropertyField {
+	if target == prefix {
+		return append(fields, PropertyField{Type: service.TypeString, Indexed: true})
+	}
+	for i := range fields {
+		fields[i].Fields = addField(fields[i].Fields, fields[i].Path, target)
+	}
+	return fields
+}
+
+func removeField(fields []PropertyField, target string) []PropertyField {
+	kept := fields[:0]
+	for _, f := range fields {
+		if f.Path == target {
+			continue
+		}
+		f.Fields = removeField(f.Fields, target)
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+func renumberFields(fields []PropertyField, prefix string) {
+	for i := range fields {
+		fields[i].Path = fmt.Sprintf("%s.%d", prefix, i)
+		renumberFields(fields[i].Fields, fields[i].Path)
+	}
+}
+
+func entityFromFields(fields []PropertyField) (service.GeneralEntity, error) {
+	entity := service.GeneralEntity{}
+	for _, f := range fields {
+		if f.Name == "" {
+			return nil, fmt.Errorf("property name is required")
+		}
+		if _, ok := entity[f.Name]; ok {
+			return nil, fmt.Errorf("duplicate property %s", f.Name)
+		}
+		value, err := valueFromField(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+		entity[f.Name] = service.OutputProperty{
+			Name:    f.Name,
+			Value:   value,
+			TypeOf:  f.Type,
+			Indexed: f.Indexed,
+		}
+	}
+	return entity, nil
+}
+
+func valueFromField(f PropertyField) (interface{}, error) {
+	switch f.Type {
+	case service.TypeEntity:
+		return entityFromFields(f.Fields)
+	case service.TypeArray:
+		values := make([]interface{}, len(f.Fields))
+		for i, item := range f.Fields {
+			value, err := valueFromField(item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %s", i, err)
+			}
+			values[i] = value
+		}
+		return values, nil
+	case service.TypeGeoPoint:
+		return service.ParsePropertyValue(f.Type, f.Lat+","+f.Lng)
+	default:
+		return service.ParsePropertyValue(f.Type, f.Value)
+	}
+}
@@ -0,0 +1,49 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestEntityFromFormArrays(t *testing.T) {
+	form := url.Values{
+		"p.0.name":    {"Tags"},
+		"p.0.type":    {service.TypeArray},
+		"p.0.0.type":  {service.TypeString},
+		"p.0.0.value": {"a"},
+		"p.0.1.type":  {service.TypeEntity},
+		// An element entity keeps the flags of its own properties
+		"p.0.1.0.name":    {"Sku"},
+		"p.0.1.0.type":    {service.TypeString},
+		"p.0.1.0.value":   {"x1"},
+		"p.0.1.0.indexed": {"on"},
+		"p.1.name":        {"Labels"},
+		"p.1.type":        {service.TypeArray},
+		"p.1.indexed":     {"on"},
+		"p.1.0.type":      {service.TypeInt64},
+		"p.1.0.value":     {"3"},
+	}
+	fields := fieldsFromForm(form, RootPath)
+	for _, f := range fields {
+		for _, item := range f.Fields {
+			if item.Indexed != f.Indexed {
+				t.Errorf("element %s indexed %v, want %v like its array %s", item.Path, item.Indexed, f.Indexed, f.Name)
+			}
+		}
+	}
+
+	entity, err := entityFromFields(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sku := service.GeneralEntity{"Sku": {Name: "Sku", Value: "x1", TypeOf: service.TypeString, Indexed: true}}
+	want := service.GeneralEntity{
+		"Tags":   {Name: "Tags", Value: []interface{}{"a", sku}, TypeOf: service.TypeArray, Indexed: false},
+		"Labels": {Name: "Labels", Value: []interface{}{int64(3)}, TypeOf: service.TypeArray, Indexed: true},
+	}
+	if !reflect.DeepEqual(entity, want) {
+		t.Errorf("entityFromFields = %v, want %v", entity, want)
+	}
+}
@@ -0,0 +1,47 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"fmt"
+	"slices"
+)
+
+// checkFilter validates a filter of the table query. Values are parsed as the
+// filter type, or as the type of the column when it has none.
+func (vm *TableViewModel) checkFilter(f service.Filter) (service.Filter, error) {
+	if f.Property == "" {
+		return f, fmt.Errorf("filter property is required")
+	}
+	if !slices.Contains(service.FilterOperators, f.Operator) {
+		return f, fmt.Errorf("unsupported filter operator %q", f.Operator)
+	}
+	if f.Type == "" {
+		f.Type = vm.propertyType(f.Property)
+	}
+	if _, err := f.ParsedValue(); err != nil {
+		return f, fmt.Errorf("filter %s: %s", f, err)
+	}
+	return f, nil
+}
+
+// propertyType is the type values of a column are compared as: the column type
+// for scalars, the element type for arrays
+func (vm *TableViewModel) propertyType(name string) string {
+	for _, h := range vm.Headers {
+		if h.Name == name && slices.Contains(service.ScalarTypes, h.Type) {
+			return h.Type
+		}
+	}
+	for _, e := range vm.Entities {
+		switch v := e[name].Value.(type) {
+		case nil, service.GeneralEntity:
+		case []interface{}:
+			if len(v) > 0 {
+				return fmt.Sprintf("%T", v[0])
+			}
+		default:
+			return fmt.Sprintf("%T", v)
+		}
+	}
+	return service.TypeString
+}
@@ -0,0 +1,125 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"context"
+	"net/url"
+
+	"cloud.google.com/go/datastore"
+)
+
+type GQLViewModel struct {
+	client      *datastore.Client
+	Namespace   string
+	Statement   string
+	Bindings    string
+	Headers     []service.TableHeader
+	View        []service.GeneralEntity
+	PageSize    int
+	CurrentPage int
+	HasNextPage bool
+	HasPrevPage bool
+	Missing     map[string]bool // encoded keys referenced on the page that have no entity
+	Display     *Display
+	Error       string
+	query       *service.GQLQuery
+	cursors     []string // start cursor of every page visited so far
+}
+
+func NewGQLViewModel(c *datastore.Client) *GQLViewModel {
+	return &GQLViewModel{
+		client:   c,
+		PageSize: 50,
+		Display:  NewDisplay(),
+	}
+}
+
+// Run parses a statement and shows the first page of its results
+func (vm *GQLViewModel) Run(ctx context.Context, namespace string, statement string, bindings string) error {
+	vm.Namespace = namespace
+	vm.Statement = statement
+	vm.Bindings = bindings
+	vm.Headers = nil
+	vm.View = nil
+	vm.CurrentPage = 0
+	vm.HasNextPage = false
+	vm.HasPrevPage = false
+	vm.Error = ""
+	vm.query = nil
+
+	values, err := service.ParseGQLBindings(bindings, namespace)
+	if err != nil {
+		vm.Error = err.Error()
+		return nil
+	}
+	query, err := service.ParseGQL(statement, namespace, values)
+	if err != nil {
+		vm.Error = err.Error()
+		return nil
+	}
+	vm.query = query
+	vm.cursors = []string{""}
+	return vm.loadPage(ctx, 0)
+}
+
+func (vm *GQLViewModel) NextPage(ctx context.Context) error {
+	if !vm.HasNextPage {
+		return nil
+	}
+	return vm.loadPage(ctx, vm.CurrentPage)
+}
+
+func (vm *GQLViewModel) PrevPage(ctx context.Context) error {
+	if !vm.HasPrevPage {
+		return nil
+	}
+	return vm.loadPage(ctx, vm.CurrentPage-2)
+}
+
+// loadPage fetches the page with index i, whose start cursor is already known
+func (vm *GQLViewModel) loadPage(ctx context.Context, i int) error {
+	vm.Error = ""
+	query := vm.query.Query
+	if i == 0 && vm.query.Offset > 0 {
+		query = query.Offset(vm.query.Offset)
+	}
+	limit := vm.PageSize
+	if vm.query.Limit > 0 {
+		limit = min(limit, vm.query.Limit-i*vm.PageSize)
+	}
+
+	entities, nextCursor, err := service.RunQuery(ctx, vm.client, query, limit, vm.cursors[i])
+	if err != nil {
+		vm.Error = err.Error()
+		return nil
+	}
+
+	missing, err := service.MissingKeys(ctx, vm.client, service.ReferencedKeys(entities))
+	if err != nil {
+		vm.Error = err.Error()
+		return nil
+	}
+
+	vm.View = entities
+	vm.Headers = service.GetTableHeaders(entities)
+	vm.Missing = missing
+	vm.CurrentPage = i + 1
+	vm.cursors = append(vm.cursors[:i+1], nextCursor)
+	vm.HasPrevPage = i > 0
+	vm.HasNextPage = nextCursor != "" && (vm.query.Limit == 0 || vm.CurrentPage*vm.PageSize < vm.query.Limit)
+	return nil
+}
+
+// ExportURL downloads every result of the last statement that ran
+func (vm *GQLViewModel) ExportURL(format string) string {
+	q := url.Values{}
+	q.Set("format", format)
+	q.Set("gql", vm.Statement)
+	if vm.Bindings != "" {
+		q.Set("bindings", vm.Bindings)
+	}
+	if vm.Namespace != "" {
+		q.Set(ParamNamespace, vm.Namespace)
+	}
+	return "/export?" + q.Encode()
+}
@@ -0,0 +1,197 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+)
+
+// ImportProgress is a snapshot of the last import of a session
+type ImportProgress struct {
+	FileName string
+	DryRun   bool
+	Running  bool
+	Rows     int // rows read without errors
+	Done     int // rows sent to Datastore so far
+	Written  int
+	Errors   []service.RowError
+	Error    string
+}
+
+// ImportViewModel reads an uploaded file and writes its rows in the background,
+// the page polls Progress until the import is no longer running
+type ImportViewModel struct {
+	client    *datastore.Client
+	stats     *StatsCache // forgets the kinds imported into
+	Namespace string
+	Kind      string
+	Format    string
+	Types     string
+
+	// Managed export in a local directory
+	BackupDir   string
+	BackupKinds []service.BackupKind
+	Error       string
+	backup      *service.Backup
+
+	mu       sync.Mutex
+	progress ImportProgress
+}
+
+func NewImportViewModel(c *datastore.Client, stats *StatsCache) *ImportViewModel {
+	return &ImportViewModel{
+		client: c,
+		stats:  stats,
+		Format: service.FormatJSONLines,
+	}
+}
+
+func (vm *ImportViewModel) Progress() ImportProgress {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	p := vm.progress
+	p.Errors = append([]service.RowError(nil), p.Errors...)
+	return p
+}
+
+func (vm *ImportViewModel) update(f func(p *ImportProgress)) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	f(&vm.progress)
+}
+
+// Start reads file and, unless dryRun, starts writing its rows. Problems with
+// the file as a whole are shown as the progress error.
+func (vm *ImportViewModel) Start(ctx context.Context, file io.Reader, fileName string, dryRun bool) {
+	if vm.Progress().Running {
+		return
+	}
+	vm.update(func(p *ImportProgress) {
+		*p = ImportProgress{FileName: fileName, DryRun: dryRun}
+	})
+
+	rows, rowErrors, err := vm.read(file)
+	vm.update(func(p *ImportProgress) {
+		p.Rows = len(rows)
+		p.Errors = rowErrors
+		if err != nil {
+			p.Error = err.Error()
+		}
+		p.Running = err == nil && !dryRun && len(rows) > 0
+	})
+	if !vm.Progress().Running {
+		return
+	}
+
+	// The import outlives the request that started it
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		written, rowErrors := service.ImportEntities(ctx, vm.client, rows, func(done int) {
+			vm.update(func(p *ImportProgress) { p.Done = done })
+		})
+		keys := make([]*datastore.Key, len(rows))
+		for i, row := range rows {
+			keys[i] = row.Key
+		}
+		vm.stats.ForgetKeys(keys)
+		vm.update(func(p *ImportProgress) {
+			p.Written = written
+			p.Errors = append(p.Errors, rowErrors...)
+			p.Running = false
+		})
+	}()
+}
+
+// OpenBackup scans the managed export in dir and lists its kinds and namespaces
+func (vm *ImportViewModel) OpenBackup(dir string) {
+	vm.BackupDir = dir
+	vm.BackupKinds = nil
+	vm.backup = nil
+	vm.Error = ""
+
+	backup, err := service.OpenBackup(dir)
+	if err == nil {
+		vm.BackupKinds, err = backup.Scan()
+	}
+	if err != nil {
+		vm.Error = err.Error()
+		return
+	}
+	vm.backup = backup
+}
+
+// BackupNamespaces lists every namespace found in the opened backup
+func (vm *ImportViewModel) BackupNamespaces() []string {
+	var namespaces []string
+	for _, bk := range vm.BackupKinds {
+		for ns := range bk.Namespaces {
+			if !slices.Contains(namespaces, ns) {
+				namespaces = append(namespaces, ns)
+			}
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// StartBackup starts loading the entities of kinds in namespaces from the opened backup
+func (vm *ImportViewModel) StartBackup(ctx context.Context, kinds []string, namespaces []string) {
+	vm.Error = ""
+	switch {
+	case vm.Progress().Running:
+		return
+	case vm.backup == nil:
+		vm.Error = "open a backup first"
+		return
+	case len(kinds) == 0 || len(namespaces) == 0:
+		vm.Error = "select at least one kind and one namespace"
+		return
+	}
+
+	total := 0
+	for _, bk := range vm.BackupKinds {
+		if slices.Contains(kinds, bk.Kind) {
+			for _, ns := range namespaces {
+				total += bk.Namespaces[ns]
+			}
+		}
+	}
+	vm.update(func(p *ImportProgress) {
+		*p = ImportProgress{FileName: vm.BackupDir, Rows: total, Running: true}
+	})
+
+	backup := vm.backup
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		written, rowErrors, err := service.LoadBackup(ctx, vm.client, backup, kinds, namespaces, func(done int) {
+			vm.update(func(p *ImportProgress) { p.Done = done })
+		})
+		for _, kind := range kinds {
+			for _, ns := range namespaces {
+				vm.stats.Forget(ns, kind)
+			}
+		}
+		vm.update(func(p *ImportProgress) {
+			p.Written = written
+			p.Errors = rowErrors
+			if err != nil {
+				p.Error = err.Error()
+			}
+			p.Running = false
+		})
+	}()
+}
+
+func (vm *ImportViewModel) read(file io.Reader) ([]service.ImportRow, []service.RowError, error) {
+	types, err := service.ParseColumnTypes(vm.Types)
+	if err != nil {
+		return nil, nil, fmt.Errorf("column types: %s", err)
+	}
+	return service.ReadImport(file, vm.Format, vm.Namespace, vm.Kind, types)
+}
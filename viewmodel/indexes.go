@@ -0,0 +1,223 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// IndexCheck checks the queries of the table against the composite indexes
+// declared in an index.yaml, as the emulator runs queries production rejects.
+// All sessions share it, pointing it at another file changes it for all of them.
+type IndexCheck struct {
+	mu      sync.RWMutex
+	path    string
+	indexes []service.Index
+}
+
+// NewIndexCheck reads the index.yaml at path, an empty path checks nothing
+// until a file is loaded
+func NewIndexCheck(path string) (*IndexCheck, error) {
+	c := &IndexCheck{}
+	if path == "" {
+		return c, nil
+	}
+	return c, c.Load(path)
+}
+
+// Load reads the index.yaml at path and checks against it from now on. The
+// indexes loaded before stay when it cannot be read.
+func (c *IndexCheck) Load(path string) error {
+	if path == "" {
+		return fmt.Errorf("No index.yaml given")
+	}
+	indexes, err := service.LoadIndexes(path)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.path = path
+	c.indexes = indexes
+	return nil
+}
+
+// Reload reads the index.yaml again, after it was edited
+func (c *IndexCheck) Reload() error {
+	return c.Load(c.Path())
+}
+
+// Path is the index.yaml checked against, empty when there is none
+func (c *IndexCheck) Path() string {
+	if c == nil {
+		return ""
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.path
+}
+
+// Indexes are the composite indexes index.yaml declares
+func (c *IndexCheck) Indexes() []service.Index {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.indexes
+}
+
+// Missing is the composite index q needs that index.yaml does not declare,
+// never anything when no index.yaml is loaded
+func (c *IndexCheck) Missing(q service.EntityQuery) (service.Index, bool) {
+	if c.Path() == "" {
+		return service.Index{}, false
+	}
+	return service.MissingIndex(q, c.Indexes())
+}
+
+// Index check actions, see TableViewModel.UpdateIndexes
+const (
+	IndexesLoad   = "load"
+	IndexesReload = "reload"
+	IndexesClear  = "clear"
+)
+
+// UpdateIndexes points the check at another index.yaml, reads it again or
+// forgets the queries run so far, and tells what it did
+func (vm *TableViewModel) UpdateIndexes(action string, path string) (string, error) {
+	switch action {
+	case IndexesLoad:
+		if err := vm.Indexes.Load(path); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Loaded %d indexes from %s", len(vm.Indexes.Indexes()), path), nil
+	case IndexesReload:
+		if err := vm.Indexes.Reload(); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Reloaded %d indexes from %s", len(vm.Indexes.Indexes()), vm.Indexes.Path()), nil
+	case IndexesClear:
+		vm.Checked = nil
+		return "Forgot the queries run so far", nil
+	}
+	return "", fmt.Errorf("unknown index action %q", action)
+}
+
+// DefaultIndexYAML is proposed to load when none is, index.yaml sits next to app.yaml
+const DefaultIndexYAML = "index.yaml"
+
+// maxCheckedQueries bounds the queries a session remembers, the oldest go first
+const maxCheckedQueries = 100
+
+// CheckedQuery is a query the table ran, kept to check it again when index.yaml changes
+type CheckedQuery struct {
+	State TableState // first page of the query
+	Runs  int
+	Last  time.Time
+}
+
+// recordQuery remembers that the table ran the query of state
+func (vm *TableViewModel) recordQuery(state TableState) {
+	state = state.FirstPage()
+	url := state.URL()
+	if i := slices.IndexFunc(vm.Checked, func(c CheckedQuery) bool { return c.State.URL() == url }); i >= 0 {
+		checked := vm.Checked[i]
+		checked.Runs++
+		checked.Last = time.Now()
+		vm.Checked = append(slices.Delete(vm.Checked, i, i+1), checked)
+		return
+	}
+	if len(vm.Checked) >= maxCheckedQueries {
+		vm.Checked = slices.Delete(vm.Checked, 0, 1)
+	}
+	vm.Checked = append(vm.Checked, CheckedQuery{State: state, Runs: 1, Last: time.Now()})
+}
+
+// MissingIndex is the composite index the query of state needs and index.yaml lacks
+func (vm *TableViewModel) MissingIndex(state TableState) (service.Index, bool) {
+	return vm.Indexes.Missing(state.Query(0))
+}
+
+// IndexWarning tells that the shown query would fail in production, empty when it would not
+func (vm *TableViewModel) IndexWarning() string {
+	idx, missing := vm.MissingIndex(vm.State())
+	if !missing {
+		return ""
+	}
+	return fmt.Sprintf("This query needs the composite index %s, which %s does not declare. Production rejects it.", idx, vm.Indexes.Path())
+}
+
+// SortConfirm asks before sorting as state when that needs an undeclared index
+func (vm *TableViewModel) SortConfirm(state TableState) string {
+	idx, missing := vm.MissingIndex(state)
+	if !missing {
+		return ""
+	}
+	return fmt.Sprintf("This sort needs the composite index %s, which %s does not declare. Sort anyway?", idx, vm.Indexes.Path())
+}
+
+// FailingQueries counts the queries this session ran that production would reject
+func (vm *TableViewModel) FailingQueries() int {
+	failing := 0
+	for _, c := range vm.Checked {
+		if _, missing := vm.MissingIndex(c.State); missing {
+			failing++
+		}
+	}
+	return failing
+}
+
+// FailingQuery is a query the table ran that needs an index index.yaml lacks
+type FailingQuery struct {
+	CheckedQuery
+	Description string
+	Index       service.Index
+}
+
+// IndexesViewModel checks the queries a session ran against index.yaml and
+// proposes the indexes it misses
+type IndexesViewModel struct {
+	Path     string // index.yaml checked against, or the one proposed to load
+	Loaded   bool
+	Declared []service.Index
+	Checked  int
+	Failing  []FailingQuery // most recent first
+	Missing  []service.Index
+	Message  string
+	Error    string
+}
+
+// NewIndexesViewModel checks the queries table ran against the current index.yaml
+func NewIndexesViewModel(table *TableViewModel) *IndexesViewModel {
+	vm := &IndexesViewModel{
+		Path:     table.Indexes.Path(),
+		Loaded:   table.Indexes.Path() != "",
+		Declared: table.Indexes.Indexes(),
+		Checked:  len(table.Checked),
+	}
+	if vm.Path == "" {
+		vm.Path = DefaultIndexYAML
+	}
+	for i := len(table.Checked) - 1; i >= 0; i-- {
+		c := table.Checked[i]
+		idx, missing := table.MissingIndex(c.State)
+		if !missing {
+			continue
+		}
+		q := c.State.Query(0)
+		vm.Failing = append(vm.Failing, FailingQuery{CheckedQuery: c, Description: q.String(), Index: idx})
+		// Queries that differ only in equality order or values need the same index
+		if !slices.ContainsFunc(vm.Missing, func(m service.Index) bool { return m.Serves(idx) }) {
+			vm.Missing = append(vm.Missing, idx)
+		}
+	}
+	return vm
+}
+
+// YAML proposes the index.yaml entries of the missing indexes
+func (vm *IndexesViewModel) YAML() string {
+	return service.IndexYAML(vm.Missing)
+}
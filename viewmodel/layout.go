@@ -0,0 +1,187 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Column layout actions, see TableViewModel.UpdateColumns
+const (
+	ColumnToggle = "toggle"
+	ColumnLeft   = "left"
+	ColumnRight  = "right"
+	ColumnPin    = "pin"
+	ColumnReset  = "reset"
+)
+
+// ColumnLayout is how the user arranged the columns of a kind. Columns not in
+// Order, like properties added later, follow the ordered ones.
+type ColumnLayout struct {
+	Order  []string `json:"order,omitempty"`
+	Hidden []string `json:"hidden,omitempty"`
+	Pinned []string `json:"pinned,omitempty"`
+}
+
+// Arrange orders headers by the layout with the pinned columns first. Hidden
+// columns are left out unless withHidden is set.
+func (l ColumnLayout) Arrange(headers []service.TableHeader, withHidden bool) []service.TableHeader {
+	arranged := make([]service.TableHeader, 0, len(headers))
+	for _, name := range l.Order {
+		if i := slices.IndexFunc(headers, func(h service.TableHeader) bool { return h.Name == name }); i >= 0 {
+			arranged = append(arranged, headers[i])
+		}
+	}
+	for _, h := range headers {
+		if !slices.Contains(l.Order, h.Name) {
+			arranged = append(arranged, h)
+		}
+	}
+	// Pinned columns keep their relative order
+	slices.SortStableFunc(arranged, func(a, b service.TableHeader) int {
+		pa, pb := l.IsPinned(a.Name), l.IsPinned(b.Name)
+		switch {
+		case pa && !pb:
+			return -1
+		case pb && !pa:
+			return 1
+		}
+		return 0
+	})
+	if !withHidden {
+		arranged = slices.DeleteFunc(arranged, func(h service.TableHeader) bool { return l.IsHidden(h.Name) })
+	}
+	return arranged
+}
+
+func (l ColumnLayout) IsHidden(name string) bool {
+	return slices.Contains(l.Hidden, name)
+}
+
+func (l ColumnLayout) IsPinned(name string) bool {
+	return slices.Contains(l.Pinned, name)
+}
+
+// Update applies action to column, headers are all columns of the kind
+func (l ColumnLayout) Update(headers []service.TableHeader, action string, column string) (ColumnLayout, error) {
+	switch action {
+	case ColumnToggle:
+		l.Hidden = toggle(l.Hidden, column)
+	case ColumnPin:
+		l.Pinned = toggle(l.Pinned, column)
+	case ColumnLeft, ColumnRight:
+		arranged := l.Arrange(headers, true)
+		order := make([]string, len(arranged))
+		for i, h := range arranged {
+			order[i] = h.Name
+		}
+		i := slices.Index(order, column)
+		j := i - 1
+		if action == ColumnRight {
+			j = i + 1
+		}
+		if i >= 0 && j >= 0 && j < len(order) && l.IsPinned(order[i]) == l.IsPinned(order[j]) {
+			order[i], order[j] = order[j], order[i]
+		}
+		l.Order = order
+	case ColumnReset:
+		return ColumnLayout{}, nil
+	default:
+		return l, fmt.Errorf("unknown column action %q", action)
+	}
+	return l, nil
+}
+
+func toggle(names []string, name string) []string {
+	if i := slices.Index(names, name); i >= 0 {
+		return slices.Delete(slices.Clone(names), i, i+1)
+	}
+	return append(slices.Clone(names), name)
+}
+
+// LayoutStore keeps the column layouts of every project, namespace and kind in
+// a JSON file so they survive restarts
+type LayoutStore struct {
+	mu      sync.Mutex
+	path    string
+	project string
+	layouts map[string]ColumnLayout
+	readErr error // why the file could not be read, it is never written then
+}
+
+// DefaultLayoutsPath is layouts.json in the user config directory
+func DefaultLayoutsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "layouts.json"
+	}
+	return filepath.Join(dir, "datastore-ui", "layouts.json")
+}
+
+// NewLayoutStore reads the layouts saved at path, a missing file is an empty
+// store. When the file cannot be read the store still works but keeps changes
+// in memory only, so it never overwrites layouts it could not read.
+func NewLayoutStore(path string, project string) (*LayoutStore, error) {
+	s := &LayoutStore{path: path, project: project, layouts: make(map[string]ColumnLayout)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err == nil {
+		if err = json.Unmarshal(data, &s.layouts); err != nil {
+			s.layouts = make(map[string]ColumnLayout)
+		}
+	}
+	if err != nil {
+		s.readErr = err
+		return s, fmt.Errorf("reading %s: %s", path, err)
+	}
+	return s, nil
+}
+
+func (s *LayoutStore) key(namespace string, kind string) string {
+	return s.project + "/" + namespace + "/" + kind
+}
+
+func (s *LayoutStore) Get(namespace string, kind string) ColumnLayout {
+	if s == nil {
+		return ColumnLayout{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.layouts[s.key(namespace, kind)]
+}
+
+// Set saves the layout of kind and writes the file, unless it could not be read
+func (s *LayoutStore) Set(namespace string, kind string, l ColumnLayout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(l.Order) == 0 && len(l.Hidden) == 0 && len(l.Pinned) == 0 {
+		delete(s.layouts, s.key(namespace, kind))
+	} else {
+		s.layouts[s.key(namespace, kind)] = l
+	}
+	if s.readErr != nil {
+		return fmt.Errorf("kept until restart, %s could not be read and is not written: %s", s.path, s.readErr)
+	}
+
+	data, err := json.MarshalIndent(s.layouts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	// Write a copy first so a crash cannot leave a truncated file behind
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
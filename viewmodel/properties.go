@@ -0,0 +1,74 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"context"
+	"net/url"
+	"slices"
+
+	"cloud.google.com/go/datastore"
+)
+
+// PropertiesViewModel is the catalogue of the indexed properties of a kind, read
+// from the metadata Datastore keeps instead of scanning entities
+type PropertiesViewModel struct {
+	client     *datastore.Client
+	Namespaces []string
+	Namespace  string
+	Kinds      []string
+	Kind       string
+	Properties []service.KindProperty
+	Error      string
+}
+
+func NewPropertiesViewModel(c *datastore.Client) *PropertiesViewModel {
+	return &PropertiesViewModel{
+		client: c,
+	}
+}
+
+// Load lists the properties of kind, the first kind of namespace when kind is
+// not one of them. Errors are shown on the page.
+func (vm *PropertiesViewModel) Load(ctx context.Context, namespace string, kind string) {
+	vm.Namespace = namespace
+	vm.Kind = kind
+
+	var err error
+	if vm.Namespaces, err = service.GetAllNamespaces(ctx, vm.client); err != nil {
+		vm.Error = err.Error()
+		return
+	}
+	if !slices.Contains(vm.Namespaces, namespace) {
+		vm.Namespaces = append([]string{namespace}, vm.Namespaces...)
+	}
+	kinds, err := service.GetAllKinds(ctx, vm.client, namespace)
+	if err != nil {
+		vm.Error = err.Error()
+		return
+	}
+	vm.Kinds = slices.DeleteFunc(kinds, service.IsStatKind)
+	if !slices.Contains(vm.Kinds, kind) {
+		if len(vm.Kinds) == 0 {
+			vm.Kind = ""
+			return
+		}
+		vm.Kind = vm.Kinds[0]
+	}
+
+	if vm.Properties, err = service.GetKindProperties(ctx, vm.client, namespace, vm.Kind); err != nil {
+		vm.Error = err.Error()
+	}
+}
+
+// URL is the catalogue of another kind
+func (vm *PropertiesViewModel) URL(namespace string, kind string) string {
+	values := url.Values{}
+	values.Set(ParamNamespace, namespace)
+	values.Set(ParamKind, kind)
+	return "/properties?" + values.Encode()
+}
+
+// SortURL opens the table of the kind sorted by property
+func (vm *PropertiesViewModel) SortURL(property string) string {
+	return TableState{Namespace: vm.Namespace}.WithKind(vm.Kind).WithSort(property, SortAsc).URL()
+}
@@ -0,0 +1,36 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+)
+
+// ReferencesViewModel lists the entities that hold a key in one of their properties
+type ReferencesViewModel struct {
+	client     *datastore.Client
+	Key        *datastore.Key
+	References []service.Reference
+}
+
+func NewReferencesViewModel(c *datastore.Client) *ReferencesViewModel {
+	return &ReferencesViewModel{
+		client: c,
+	}
+}
+
+func (vm *ReferencesViewModel) Load(ctx context.Context, encodedKey string) error {
+	key, err := datastore.DecodeKey(encodedKey)
+	if err != nil {
+		return fmt.Errorf("invalid key %q", encodedKey)
+	}
+	references, err := service.FindReferences(ctx, vm.client, key)
+	if err != nil {
+		return err
+	}
+	vm.Key = key
+	vm.References = references
+	return nil
+}
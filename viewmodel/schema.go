@@ -0,0 +1,54 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"context"
+	"net/url"
+	"strconv"
+
+	"cloud.google.com/go/datastore"
+)
+
+// SchemaSamples are the sample sizes offered on the schema page, 0 scans the whole kind
+var SchemaSamples = []int{100, 1000, 10000, 0}
+
+const DefaultSchemaSample = 1000
+
+// SchemaViewModel reports the properties of a kind and the types they have
+type SchemaViewModel struct {
+	client    *datastore.Client
+	Namespace string
+	Kind      string
+	Sample    int
+	Schema    *service.KindSchema
+	Error     string
+}
+
+func NewSchemaViewModel(c *datastore.Client) *SchemaViewModel {
+	return &SchemaViewModel{
+		client: c,
+		Sample: DefaultSchemaSample,
+	}
+}
+
+// Load scans up to sample entities of kind, scan errors are shown on the page
+func (vm *SchemaViewModel) Load(ctx context.Context, namespace string, kind string, sample int) {
+	vm.Namespace = namespace
+	vm.Kind = kind
+	vm.Sample = sample
+	schema, err := service.InspectKind(ctx, vm.client, namespace, kind, sample)
+	if err != nil {
+		vm.Error = err.Error()
+		return
+	}
+	vm.Schema = schema
+}
+
+// URL is the schema page of the same kind with another sample size
+func (vm *SchemaViewModel) URL(sample int) string {
+	values := url.Values{}
+	values.Set(ParamNamespace, vm.Namespace)
+	values.Set(ParamKind, vm.Kind)
+	values.Set("sample", strconv.Itoa(sample))
+	return "/schema?" + values.Encode()
+}
@@ -0,0 +1,147 @@
+package viewmodel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Session holds the view state of one browser tab. Lock it while handling a request.
+type Session struct {
+	sync.Mutex
+	lastSeen time.Time
+	Table    *TableViewModel
+	GQL      *GQLViewModel
+	Jobs     *Jobs // shared by the tabs of the browser
+}
+
+// Jobs are the imports and stats scans of one browser. They run in the
+// background, so they belong to the browser rather than a tab: every tab, and
+// a tab opened again, finds them. Lock it while starting or changing a job.
+type Jobs struct {
+	sync.Mutex
+	Import *ImportViewModel
+	Stats  *StatsViewModel
+}
+
+// Running reports whether an import or a stats scan is in progress
+func (j *Jobs) Running() bool {
+	return j.Import.Progress().Running || j.Stats.Progress().Running
+}
+
+// browser is the sessions of the tabs of one browser and its jobs
+type browser struct {
+	tabs map[string]*Session
+	jobs *Jobs
+}
+
+// SessionStore keeps one Session per browser tab, under the id of the browser
+// and the id of the tab, and drops sessions idle for longer than idle
+type SessionStore struct {
+	mu       sync.Mutex
+	client   *datastore.Client
+	layouts  *LayoutStore
+	indexes  *IndexCheck
+	stats    *StatsCache
+	idle     time.Duration
+	browsers map[string]*browser
+}
+
+func NewSessionStore(c *datastore.Client, layouts *LayoutStore, indexes *IndexCheck, stats *StatsCache, idle time.Duration) *SessionStore {
+	return &SessionStore{
+		client:   c,
+		layouts:  layouts,
+		indexes:  indexes,
+		stats:    stats,
+		idle:     idle,
+		browsers: make(map[string]*browser),
+	}
+}
+
+// Get returns the session of tab in the browser with the given id. A new browser
+// id is made when the id is unknown, and a new session, reported as new, when
+// the tab has none or it expired.
+func (s *SessionStore) Get(id string, tab string) (string, *Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.browsers[id]
+	if !ok {
+		id = newSessionID()
+		b = &browser{
+			tabs: make(map[string]*Session),
+			jobs: &Jobs{
+				Import: NewImportViewModel(s.client, s.stats),
+				Stats:  NewStatsViewModel(s.client, s.stats),
+			},
+		}
+		s.browsers[id] = b
+	}
+	now := time.Now()
+	if session, ok := b.tabs[tab]; ok && now.Sub(session.lastSeen) < s.idle {
+		session.lastSeen = now
+		return id, session, false
+	}
+
+	session := &Session{
+		lastSeen: now,
+		Table:    NewTableViewModel(s.client),
+		GQL:      NewGQLViewModel(s.client),
+		Jobs:     b.jobs,
+	}
+	session.Table.Layouts = s.layouts
+	session.Table.Indexes = s.indexes
+	session.Table.Stats = s.stats
+	// Both tables show values the same way
+	session.GQL.Display = session.Table.Display
+	b.tabs[tab] = session
+	return id, session, true
+}
+
+// Expire drops idle sessions, and browsers left without any unless one of
+// their jobs still runs, and returns how many sessions were dropped
+func (s *SessionStore) Expire() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := 0
+	now := time.Now()
+	for id, b := range s.browsers {
+		for tab, session := range b.tabs {
+			if now.Sub(session.lastSeen) >= s.idle {
+				delete(b.tabs, tab)
+				expired++
+			}
+		}
+		if len(b.tabs) == 0 && !b.jobs.Running() {
+			delete(s.browsers, id)
+		}
+	}
+	return expired
+}
+
+// ExpireEvery runs Expire periodically until ctx is done
+func (s *SessionStore) ExpireEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Expire()
+		}
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,386 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"cloud.google.com/go/datastore"
+)
+
+// TableState is everything that decides what the table shows. It round-trips
+// through the query string so every view can be bookmarked and shared.
+type TableState struct {
+	Namespace string
+	Kind      string
+	Sorts     []service.Order
+	Filters   []service.Filter
+	Ancestor  string // encoded key whose descendants are shown, empty for all entities
+	Cursor    string // start of the shown page, empty for the first page
+	Page      int    // number of the shown page, only used for display
+}
+
+// Query string parameters of a TableState. Sort orders repeat the sort and
+// direction parameters, filters are spread over four parameters that repeat
+// once per filter, in the same order.
+const (
+	ParamNamespace   = "ns"
+	ParamKind        = "kind"
+	ParamSort        = "sort"
+	ParamDirection   = "dir"
+	ParamFilterName  = "fp"
+	ParamFilterOp    = "fo"
+	ParamFilterValue = "fv"
+	ParamFilterType  = "ft"
+	ParamAncestor    = "anc"
+	ParamCursor      = "cursor"
+	ParamPage        = "page"
+)
+
+// Sort directions
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+func ParseTableState(q url.Values) TableState {
+	state := TableState{
+		Namespace: q.Get(ParamNamespace),
+		Kind:      q.Get(ParamKind),
+		Ancestor:  q.Get(ParamAncestor),
+		Cursor:    q.Get(ParamCursor),
+	}
+	for i, property := range q[ParamSort] {
+		if property == "" || slices.ContainsFunc(state.Sorts, func(o service.Order) bool { return o.Property == property }) {
+			continue
+		}
+		direction := SortAsc
+		if nth(q[ParamDirection], i) == SortDesc {
+			direction = SortDesc
+		}
+		state.Sorts = append(state.Sorts, service.Order{Property: property, Direction: direction})
+	}
+
+	for i, property := range q[ParamFilterName] {
+		state.Filters = append(state.Filters, service.Filter{
+			Property: property,
+			Operator: nth(q[ParamFilterOp], i),
+			Value:    nth(q[ParamFilterValue], i),
+			Type:     nth(q[ParamFilterType], i),
+		})
+	}
+
+	state.Page, _ = strconv.Atoi(q.Get(ParamPage))
+	if state.Cursor == "" || state.Page < 1 {
+		state.Page = 1
+	}
+	return state
+}
+
+func encodeKey(k *datastore.Key) string {
+	if k == nil {
+		return ""
+	}
+	return k.Encode()
+}
+
+func nth(values []string, i int) string {
+	if i < len(values) {
+		return values[i]
+	}
+	return ""
+}
+
+// Values is the query string form of the state, leaving out defaults
+func (s TableState) Values() url.Values {
+	q := url.Values{}
+	set := func(name string, value string) {
+		if value != "" {
+			q.Set(name, value)
+		}
+	}
+	set(ParamNamespace, s.Namespace)
+	set(ParamKind, s.Kind)
+	for _, o := range s.Sorts {
+		q.Add(ParamSort, o.Property)
+		q.Add(ParamDirection, o.Direction)
+	}
+	for _, f := range s.Filters {
+		q.Add(ParamFilterName, f.Property)
+		q.Add(ParamFilterOp, f.Operator)
+		q.Add(ParamFilterValue, f.Value)
+		q.Add(ParamFilterType, f.Type)
+	}
+	set(ParamAncestor, s.Ancestor)
+	if s.Cursor != "" {
+		q.Set(ParamCursor, s.Cursor)
+		q.Set(ParamPage, strconv.Itoa(s.Page))
+	}
+	return q
+}
+
+func (s TableState) URL() string {
+	if q := s.Values().Encode(); q != "" {
+		return "/?" + q
+	}
+	return "/"
+}
+
+// Query is the query of the state, filters without a type compare as strings.
+// An ancestor that is not a valid key is left out.
+func (s TableState) Query(limit int) service.EntityQuery {
+	filters := make([]service.Filter, len(s.Filters))
+	for i, f := range s.Filters {
+		if f.Type == "" {
+			f.Type = service.TypeString
+		}
+		filters[i] = f
+	}
+	ancestor, _ := datastore.DecodeKey(s.Ancestor)
+	return service.EntityQuery{
+		Namespace: s.Namespace,
+		Kind:      s.Kind,
+		Filters:   filters,
+		Ancestor:  ancestor,
+		Orders:    s.Sorts,
+		Limit:     limit,
+		Cursor:    s.Cursor,
+	}
+}
+
+// ExportURL downloads every entity of the query in one of service.ExportFormats
+func (s TableState) ExportURL(format string) string {
+	q := s.FirstPage().Values()
+	q.Set("format", format)
+	return "/export?" + q.Encode()
+}
+
+// WithKind is the first page of another kind in the same namespace
+func (s TableState) WithKind(kind string) TableState {
+	return TableState{Namespace: s.Namespace, Kind: kind, Page: 1}
+}
+
+// WithSort is the first page sorted by key only, or unsorted when key is empty
+func (s TableState) WithSort(key string, direction string) TableState {
+	if key == "" {
+		return s.WithSorts(nil)
+	}
+	return s.WithSorts([]service.Order{{Property: key, Direction: direction}})
+}
+
+// WithSorts is the first page sorted by orders, the first one sorting first
+func (s TableState) WithSorts(orders []service.Order) TableState {
+	s.Sorts = orders
+	return s.FirstPage()
+}
+
+// WithoutFilter is the first page without the i-th filter
+func (s TableState) WithoutFilter(i int) TableState {
+	s.Filters = slices.Delete(slices.Clone(s.Filters), i, i+1)
+	return s.FirstPage()
+}
+
+// WithoutAncestor is the first page of every entity of the kind
+func (s TableState) WithoutAncestor() TableState {
+	s.Ancestor = ""
+	return s.FirstPage()
+}
+
+// WithoutFilters is the first page without any filter
+func (s TableState) WithoutFilters() TableState {
+	s.Filters = nil
+	return s.FirstPage()
+}
+
+// FirstPage is the same query from its first page
+func (s TableState) FirstPage() TableState {
+	s.Cursor = ""
+	s.Page = 1
+	return s
+}
+
+// State is the state the table currently shows
+func (vm *TableViewModel) State() TableState {
+	state := TableState{
+		Namespace: vm.Namespace,
+		Kind:      vm.Selected,
+		Sorts:     vm.Sorts,
+		Filters:   vm.Filters,
+		Ancestor:  encodeKey(vm.Ancestor),
+		Page:      vm.PageOffset + max(vm.CurrentPage, 1),
+	}
+	if vm.CurrentPage > 0 {
+		state.Cursor = vm.pageCursors[vm.CurrentPage-1]
+	}
+	return state
+}
+
+// SortOrder is the position of key among the sort orders, from 1, and its
+// direction, or 0 when the table is not sorted by key
+func (vm *TableViewModel) SortOrder(key string) (int, string) {
+	for i, o := range vm.Sorts {
+		if o.Property == key {
+			return i + 1, o.Direction
+		}
+	}
+	return 0, ""
+}
+
+// SortState is the state after clicking the header of key: sort by key only,
+// descending, then ascending, then unsorted
+func (vm *TableViewModel) SortState(key string) TableState {
+	state := vm.State()
+	if len(vm.Sorts) != 1 || vm.Sorts[0].Property != key {
+		return state.WithSort(key, SortDesc)
+	}
+	if vm.Sorts[0].Direction == SortDesc {
+		return state.WithSort(key, SortAsc)
+	}
+	return state.WithSort("", "")
+}
+
+// AddSortState is the state after shift-clicking the header of key: key sorts
+// descending after the current orders, then ascending in the same place, then
+// not at all
+func (vm *TableViewModel) AddSortState(key string) TableState {
+	orders := slices.Clone(vm.Sorts)
+	i := slices.IndexFunc(orders, func(o service.Order) bool { return o.Property == key })
+	switch {
+	case i < 0:
+		orders = append(orders, service.Order{Property: key, Direction: SortDesc})
+	case orders[i].Direction == SortDesc:
+		orders[i].Direction = SortAsc
+	default:
+		orders = slices.Delete(orders, i, i+1)
+	}
+	return vm.State().WithSorts(orders)
+}
+
+// PrevState is the page before the current one, if it was fetched in this session
+func (vm *TableViewModel) PrevState() TableState {
+	state := vm.State()
+	if vm.CurrentPage > 1 {
+		state.Cursor = vm.pageCursors[vm.CurrentPage-2]
+		state.Page--
+	}
+	return state
+}
+
+func (vm *TableViewModel) NextState() TableState {
+	state := vm.State()
+	if vm.CurrentPage < vm.Pages {
+		state.Cursor = vm.pageCursors[vm.CurrentPage]
+	} else {
+		state.Cursor = vm.Cursor
+	}
+	state.Page++
+	return state
+}
+
+// Apply makes the table show state. Pages fetched earlier are reused as long as
+// the namespace, kind, sort and filters stay the same.
+func (vm *TableViewModel) Apply(ctx context.Context, state TableState) error {
+	if state.Namespace != vm.Namespace {
+		vm.SelectNamespace(state.Namespace)
+	}
+	if err := vm.UpdateNamespaces(ctx); err != nil {
+		return err
+	}
+	if err := vm.UpdateKinds(ctx); err != nil {
+		return err
+	}
+
+	if state.Kind != vm.Selected {
+		vm.SelectKind(state.Kind)
+	}
+	if vm.Selected == "" {
+		return nil
+	}
+
+	if !slices.Equal(state.Sorts, vm.Sorts) {
+		vm.Sorts = state.Sorts
+		vm.Refresh()
+	}
+
+	// Invalid filters are reported and left out, the valid ones still apply
+	var filters []service.Filter
+	var filterErr error
+	for _, f := range state.Filters {
+		f, err := vm.checkFilter(f)
+		if err != nil {
+			filterErr = err
+			continue
+		}
+		filters = append(filters, f)
+	}
+	if !slices.Equal(filters, vm.Filters) {
+		vm.Filters = filters
+		vm.Refresh()
+	}
+
+	var ancestor *datastore.Key
+	if state.Ancestor != "" {
+		var err error
+		if ancestor, err = datastore.DecodeKey(state.Ancestor); err != nil {
+			filterErr = fmt.Errorf("invalid ancestor key %q", state.Ancestor)
+		}
+	}
+	if !ancestor.Equal(vm.Ancestor) {
+		vm.Ancestor = ancestor
+		vm.Refresh()
+	}
+
+	if err := vm.showPage(ctx, state.Cursor, state.Page); err != nil {
+		return err
+	}
+	return filterErr
+}
+
+// showPage makes the page starting at cursor current, fetching it unless it
+// was fetched before
+func (vm *TableViewModel) showPage(ctx context.Context, cursor string, page int) error {
+	if i := slices.Index(vm.pageCursors, cursor); i >= 0 {
+		vm.CurrentPage = i + 1
+	} else if cursor != "" && cursor == vm.Cursor {
+		if err := vm.GetNewPage(ctx); err != nil {
+			return err
+		}
+	} else {
+		// Opened at a cursor this session has not seen, start fetching there
+		vm.Refresh()
+		vm.Cursor = cursor
+		if err := vm.GetNewPage(ctx); err != nil {
+			return err
+		}
+		vm.PageOffset = page - 1
+	}
+
+	vm.HasPrevPage = vm.CurrentPage > 1
+	vm.HasNextPage = vm.CurrentPage < vm.Pages || vm.Cursor != ""
+
+	start := (vm.CurrentPage - 1) * vm.PageSize
+	end := min(vm.CurrentPage*vm.PageSize, len(vm.Entities))
+	vm.View = vm.Entities[start:end]
+	// The columns are every property of the kind, not only those on the page, so
+	// they stay put while paging. __property__ lists indexed properties only, the
+	// unindexed ones come from the pages fetched since the kind was opened,
+	// whatever the sort and filters. The saved layout only orders and pins them.
+	if vm.kindHeaders == nil {
+		properties, err := service.GetKindProperties(ctx, vm.client, vm.Namespace, vm.Selected)
+		if err != nil {
+			return err
+		}
+		vm.kindHeaders = service.PropertyHeaders(properties)
+	}
+	vm.seenHeaders = service.MergeHeaders(vm.seenHeaders, service.GetTableHeaders(vm.View))
+	vm.Headers = service.MergeHeaders(vm.kindHeaders, vm.seenHeaders)
+	missing, err := service.MissingKeys(ctx, vm.client, service.ReferencedKeys(vm.View))
+	if err != nil {
+		return err
+	}
+	vm.Missing = missing
+	return nil
+}
@@ -0,0 +1,203 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+)
+
+func TestTableStateURLRoundTrip(t *testing.T) {
+	ancestor := datastore.NameKey("User", "alice", nil).Encode()
+	tests := []struct {
+		name  string
+		state TableState
+		url   string
+	}{
+		{
+			name:  "first page of nothing",
+			state: TableState{Page: 1},
+			url:   "/",
+		},
+		{
+			name:  "kind in a namespace",
+			state: TableState{Namespace: "ns", Kind: "User", Page: 1},
+			url:   "/?kind=User&ns=ns",
+		},
+		{
+			name: "sorts filters ancestor and page",
+			state: TableState{
+				Namespace: "ns",
+				Kind:      "User Profile",
+				Sorts:     []service.Order{{Property: "Age", Direction: SortDesc}, {Property: "first name", Direction: SortAsc}},
+				Filters: []service.Filter{
+					{Property: "Active", Operator: "=", Value: "true", Type: service.TypeBool},
+					{Property: "Role", Operator: "in", Value: "admin, owner", Type: service.TypeString},
+				},
+				Ancestor: ancestor,
+				Cursor:   "CjISLGoP",
+				Page:     3,
+			},
+			url: "/?anc=" + ancestor + "&cursor=CjISLGoP&dir=desc&dir=asc" +
+				"&fo=%3D&fo=in&fp=Active&fp=Role&ft=bool&ft=string&fv=true&fv=admin%2C+owner" +
+				"&kind=User+Profile&ns=ns&page=3&sort=Age&sort=first+name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.URL(); got != tt.url {
+				t.Errorf("URL = %s, want %s", got, tt.url)
+			}
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ParseTableState(u.Query()); !reflect.DeepEqual(got, tt.state) {
+				t.Errorf("ParseTableState(%s) = %+v, want %+v", tt.url, got, tt.state)
+			}
+		})
+	}
+}
+
+func TestParseTableStateDefaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  TableState
+	}{
+		{
+			name:  "page without a cursor is the first",
+			query: "kind=User&page=4",
+			want:  TableState{Kind: "User", Page: 1},
+		},
+		{
+			name:  "invalid page",
+			query: "kind=User&cursor=abc&page=x",
+			want:  TableState{Kind: "User", Cursor: "abc", Page: 1},
+		},
+		{
+			name:  "direction defaults to ascending",
+			query: "kind=User&sort=Age&sort=Name&dir=desc",
+			want: TableState{Kind: "User", Page: 1,
+				Sorts: []service.Order{{Property: "Age", Direction: SortDesc}, {Property: "Name", Direction: SortAsc}}},
+		},
+		{
+			name:  "repeated and empty sorts are dropped",
+			query: "kind=User&sort=Age&dir=desc&sort=Age&dir=asc&sort=&dir=asc",
+			want:  TableState{Kind: "User", Page: 1, Sorts: []service.Order{{Property: "Age", Direction: SortDesc}}},
+		},
+		{
+			name:  "filter with missing parameters",
+			query: "kind=User&fp=Age&fo=%3E",
+			want:  TableState{Kind: "User", Page: 1, Filters: []service.Filter{{Property: "Age", Operator: ">"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ParseTableState(q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTableState(%s) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableStateTransitions(t *testing.T) {
+	state := TableState{
+		Namespace: "ns",
+		Kind:      "User",
+		Sorts:     []service.Order{{Property: "Age", Direction: SortDesc}},
+		Filters:   []service.Filter{{Property: "A", Operator: "=", Value: "1"}, {Property: "B", Operator: "=", Value: "2"}},
+		Ancestor:  "anc",
+		Cursor:    "c",
+		Page:      2,
+	}
+	if got := state.WithKind("Purchase"); !reflect.DeepEqual(got, TableState{Namespace: "ns", Kind: "Purchase", Page: 1}) {
+		t.Errorf("WithKind = %+v", got)
+	}
+	if got := state.WithoutFilter(0); got.Cursor != "" || got.Page != 1 || !reflect.DeepEqual(got.Filters, state.Filters[1:]) {
+		t.Errorf("WithoutFilter(0) = %+v", got)
+	}
+	if len(state.Filters) != 2 || state.Filters[0].Property != "A" {
+		t.Errorf("WithoutFilter changed the filters of the state it was called on: %+v", state.Filters)
+	}
+	if got := state.WithoutAncestor(); got.Ancestor != "" || got.Cursor != "" {
+		t.Errorf("WithoutAncestor = %+v", got)
+	}
+	if got := state.WithSort("", ""); got.Sorts != nil || got.Page != 1 {
+		t.Errorf("WithSort(\"\") = %+v", got)
+	}
+	if got := ParseTableState(mustQuery(t, state.ExportURL("csv"))); got.Cursor != "" || got.Kind != "User" {
+		t.Errorf("ExportURL starts at %+v, want the first page", got)
+	}
+}
+
+func TestSortStateCycles(t *testing.T) {
+	vm := &TableViewModel{Namespace: "ns", Selected: "User"}
+	var sorts [][]service.Order
+	for i := 0; i < 3; i++ {
+		vm.Sorts = vm.SortState("Age").Sorts
+		sorts = append(sorts, vm.Sorts)
+	}
+	want := [][]service.Order{{{Property: "Age", Direction: SortDesc}}, {{Property: "Age", Direction: SortAsc}}, nil}
+	if !reflect.DeepEqual(sorts, want) {
+		t.Errorf("clicking Age sorts by %v, want %v", sorts, want)
+	}
+
+	vm.Sorts = []service.Order{{Property: "Name", Direction: SortAsc}}
+	sorts = nil
+	for i := 0; i < 3; i++ {
+		vm.Sorts = vm.AddSortState("Age").Sorts
+		sorts = append(sorts, vm.Sorts)
+	}
+	name := service.Order{Property: "Name", Direction: SortAsc}
+	want = [][]service.Order{
+		{name, {Property: "Age", Direction: SortDesc}},
+		{name, {Property: "Age", Direction: SortAsc}},
+		{name},
+	}
+	if !reflect.DeepEqual(sorts, want) {
+		t.Errorf("shift-clicking Age sorts by %v, want %v", sorts, want)
+	}
+}
+
+func TestStatePaging(t *testing.T) {
+	vm := &TableViewModel{Selected: "User", pageCursors: []string{"", "c2", "c3"}, Pages: 3, Cursor: "c4"}
+
+	vm.CurrentPage = 2
+	if got := vm.State(); got.Cursor != "c2" || got.Page != 2 {
+		t.Errorf("State on page 2 = %+v", got)
+	}
+	if got := vm.PrevState(); got.Cursor != "" || got.Page != 1 {
+		t.Errorf("PrevState on page 2 = %+v", got)
+	}
+	if got := vm.NextState(); got.Cursor != "c3" || got.Page != 3 {
+		t.Errorf("NextState on page 2 = %+v", got)
+	}
+
+	vm.CurrentPage = 3
+	if got := vm.NextState(); got.Cursor != "c4" || got.Page != 4 {
+		t.Errorf("NextState on the last fetched page = %+v, want the cursor after it", got)
+	}
+
+	// Opened at a cursor, the pages before it were never fetched
+	vm.PageOffset = 9
+	vm.CurrentPage = 1
+	if got := vm.State(); got.Page != 10 {
+		t.Errorf("State opened at page 10 = %+v", got)
+	}
+}
+
+func mustQuery(t *testing.T, rawURL string) url.Values {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
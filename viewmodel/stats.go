@@ -0,0 +1,186 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+)
+
+// StatsRow is one kind of the stats page, Stats is nil until the kind is scanned
+// or has built-in statistics
+type StatsRow struct {
+	Namespace string
+	Kind      string
+	Stats     *service.KindStats
+}
+
+// StatsProgress is a snapshot of the running scan
+type StatsProgress struct {
+	Running   bool
+	Namespace string
+	Kind      string
+	Kinds     int // kinds to scan
+	KindsDone int
+	Done      int // entities of Kind read so far
+	Total     int
+	Error     string
+}
+
+type statsKey struct {
+	namespace string
+	kind      string
+}
+
+// StatsCache keeps the stats of scanned kinds for every session, until the
+// kind is written to. A nil cache keeps nothing.
+type StatsCache struct {
+	mu    sync.Mutex
+	stats map[statsKey]service.KindStats
+}
+
+func NewStatsCache() *StatsCache {
+	return &StatsCache{stats: make(map[statsKey]service.KindStats)}
+}
+
+func (c *StatsCache) Get(namespace string, kind string) (service.KindStats, bool) {
+	if c == nil {
+		return service.KindStats{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats, ok := c.stats[statsKey{namespace, kind}]
+	return stats, ok
+}
+
+func (c *StatsCache) Set(namespace string, kind string, stats service.KindStats) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats[statsKey{namespace, kind}] = stats
+}
+
+// Forget drops the stats of kind, call it after writing to or deleting from it
+func (c *StatsCache) Forget(namespace string, kind string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.stats, statsKey{namespace, kind})
+}
+
+// ForgetKeys drops the stats of the kinds of keys
+func (c *StatsCache) ForgetKeys(keys []*datastore.Key) {
+	for _, key := range keys {
+		if key != nil {
+			c.Forget(key.Namespace, key.Kind)
+		}
+	}
+}
+
+// StatsViewModel scans kinds in the background into a cache shared with the
+// other sessions
+type StatsViewModel struct {
+	client *datastore.Client
+	cache  *StatsCache
+
+	mu       sync.Mutex
+	progress StatsProgress
+}
+
+func NewStatsViewModel(c *datastore.Client, cache *StatsCache) *StatsViewModel {
+	return &StatsViewModel{
+		client: c,
+		cache:  cache,
+	}
+}
+
+func (vm *StatsViewModel) Progress() StatsProgress {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	return vm.progress
+}
+
+func (vm *StatsViewModel) update(f func(p *StatsProgress)) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	f(&vm.progress)
+}
+
+// Rows lists every kind of every namespace with its stats: scanned ones first,
+// then the built-in statistics when Datastore keeps them
+func (vm *StatsViewModel) Rows(ctx context.Context) ([]StatsRow, error) {
+	namespaces, err := service.GetAllNamespaces(ctx, vm.client)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(namespaces)
+
+	var rows []StatsRow
+	for _, namespace := range namespaces {
+		kinds, err := service.GetAllKinds(ctx, vm.client, namespace)
+		if err != nil {
+			return nil, err
+		}
+		statKinds, err := service.GetStatKinds(ctx, vm.client, namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, kind := range kinds {
+			if service.IsStatKind(kind) {
+				continue
+			}
+			row := StatsRow{Namespace: namespace, Kind: kind}
+			stats, ok := vm.cache.Get(namespace, kind)
+			if !ok {
+				stats, ok = statKinds[kind]
+			}
+			if ok {
+				row.Stats = &stats
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// StartScan scans the given rows one kind after the other
+func (vm *StatsViewModel) StartScan(ctx context.Context, rows []StatsRow) {
+	if vm.Progress().Running || len(rows) == 0 {
+		return
+	}
+	vm.update(func(p *StatsProgress) {
+		*p = StatsProgress{Running: true, Kinds: len(rows)}
+	})
+
+	// The scan outlives the request that started it
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		for i, row := range rows {
+			vm.update(func(p *StatsProgress) {
+				p.Namespace, p.Kind, p.KindsDone, p.Done, p.Total = row.Namespace, row.Kind, i, 0, 0
+			})
+			stats, err := service.ScanKind(ctx, vm.client, row.Namespace, row.Kind, func(done int, total int) {
+				vm.update(func(p *StatsProgress) { p.Done, p.Total = done, total })
+			})
+			if err != nil {
+				vm.update(func(p *StatsProgress) {
+					p.Error = fmt.Sprintf("scanning %s: %s", row.Kind, err)
+					p.Running = false
+				})
+				return
+			}
+			vm.cache.Set(row.Namespace, row.Kind, stats)
+		}
+		vm.update(func(p *StatsProgress) {
+			p.KindsDone = len(rows)
+			p.Running = false
+		})
+	}()
+}
@@ -0,0 +1,88 @@
+package viewmodel
+
+import (
+	"backend/service"
+	"context"
+	"fmt"
+	"net/url"
+
+	"cloud.google.com/go/datastore"
+)
+
+// TreeViewModel shows the root keys of a kind, their children are loaded one
+// level at a time with Children
+type TreeViewModel struct {
+	client    *datastore.Client
+	Namespace string
+	Kind      string
+	Cursor    string // of the shown page of keys
+	Roots     []*datastore.Key
+	Next      string // cursor of the next page of keys, empty on the last page
+}
+
+// TreeNode is a key and its children grouped by kind
+type TreeNode struct {
+	Key      *datastore.Key
+	Children *service.TreeChildren
+}
+
+func NewTreeViewModel(c *datastore.Client) *TreeViewModel {
+	return &TreeViewModel{
+		client: c,
+	}
+}
+
+func (vm *TreeViewModel) Load(ctx context.Context, namespace string, kind string, cursor string) error {
+	roots, next, err := service.RootKeys(ctx, vm.client, namespace, kind, cursor)
+	if err != nil {
+		return err
+	}
+	vm.Namespace = namespace
+	vm.Kind = kind
+	vm.Cursor = cursor
+	vm.Roots = roots
+	vm.Next = next
+	return nil
+}
+
+// Children loads the children of the key encodedKey
+func (vm *TreeViewModel) Children(ctx context.Context, encodedKey string) (*TreeNode, error) {
+	key, err := datastore.DecodeKey(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %q", encodedKey)
+	}
+	children, err := service.Children(ctx, vm.client, key)
+	if err != nil {
+		return nil, err
+	}
+	return &TreeNode{Key: key, Children: children}, nil
+}
+
+// NextURL is the next page of root keys
+func (vm *TreeViewModel) NextURL() string {
+	q := url.Values{}
+	q.Set(ParamNamespace, vm.Namespace)
+	q.Set(ParamKind, vm.Kind)
+	q.Set(ParamCursor, vm.Next)
+	return "/tree?" + q.Encode()
+}
+
+// KeyTableState is the table of the kind of key showing only key
+func KeyTableState(key *datastore.Key) TableState {
+	return TableState{
+		Namespace: key.Namespace,
+		Kind:      key.Kind,
+		Filters:   []service.Filter{{Property: "key", Operator: "=", Value: key.Encode(), Type: service.TypeKey}},
+		Page:      1,
+	}
+}
+
+// DescendantsTableState is the table of the entities of kind below key, at any depth
+func DescendantsTableState(key *datastore.Key, kind string) TableState {
+	return TableState{
+		Namespace: key.Namespace,
+		Kind:      kind,
+		Ancestor:  key.Encode(),
+		Page:      1,
+	}
+}
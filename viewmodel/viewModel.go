@@ -5,25 +5,42 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
 
 	"cloud.google.com/go/datastore"
 )
 
 type TableViewModel struct {
-	Kinds         []string // List of fruit names for the datalist.
-	Selected      string
-	client        *datastore.Client
-	Headers       []service.TableHeader
-	Entities      []service.GeneralEntity
-	View          []service.GeneralEntity
-	Cursor        string
-	PageSize      int
-	HasNextPage   bool
-	HasPrevPage   bool
-	CurrentPage   int
-	Pages         int
-	SortKey       string
-	SortDirection string
+	Namespaces  []string
+	Namespace   string
+	Kinds       []string // List of fruit names for the datalist.
+	Selected    string
+	client      *datastore.Client
+	Headers     []service.TableHeader
+	kindHeaders []service.TableHeader // columns of every indexed property of the kind
+	seenHeaders []service.TableHeader // columns met on any page of the kind, unindexed ones included
+	Entities    []service.GeneralEntity
+	View        []service.GeneralEntity
+	Cursor      string
+	PageSize    int
+	HasNextPage bool
+	HasPrevPage bool
+	CurrentPage int
+	Pages       int
+	PageOffset  int      // pages before the first fetched one, when opened at a cursor
+	pageCursors []string // start cursor of every fetched page
+	Sorts       []service.Order
+	Filters     []service.Filter
+	Ancestor    *datastore.Key  // only descendants of Ancestor are shown, when set
+	Missing     map[string]bool // encoded keys referenced on the page that have no entity
+	Display     *Display
+	Layouts     *LayoutStore   // nil when column layouts are not saved
+	ColumnsOpen bool           // keep the column chooser open after a change
+	Indexes     *IndexCheck    // shared by all sessions, nil in the terminal UI
+	Stats       *StatsCache    // shared by all sessions, forgets the kinds deleted from
+	Checked     []CheckedQuery // queries run in this session, oldest first
+	Message     string
+	Error       string
 }
 
 func NewTableViewModel(c *datastore.Client) *TableViewModel {
@@ -31,37 +48,50 @@ func NewTableViewModel(c *datastore.Client) *TableViewModel {
 		client:   c,
 		PageSize: 50,
 		Cursor:   "",
+		Display:  NewDisplay(),
 	}
 
 }
 
-func (vm *TableViewModel) UpdateKinds(ctx context.Context) error {
+func (vm *TableViewModel) UpdateNamespaces(ctx context.Context) error {
 
-	kinds, err := service.GetAllKinds(ctx, vm.client)
+	namespaces, err := service.GetAllNamespaces(ctx, vm.client)
 	if err != nil {
-		log.Fatal(err)
 		return err
 	}
-	vm.Kinds = kinds
+	// The selected namespace may be empty, keep it listed so it stays selectable
+	if !slices.Contains(namespaces, vm.Namespace) {
+		namespaces = append([]string{vm.Namespace}, namespaces...)
+	}
+	vm.Namespaces = namespaces
 	return nil
 }
 
-func (vm *TableViewModel) SelectKind(kind string) error {
-	vm.Selected = kind
+func (vm *TableViewModel) SelectNamespace(namespace string) error {
+	vm.Namespace = namespace
+	vm.Selected = ""
+	vm.Filters = nil
+	vm.Ancestor = nil
 	vm.Reset()
 	return nil
-
 }
 
-func (vm *TableViewModel) ToggleSortDirection() {
-	newSortDirection := ""
-	if vm.SortDirection == "" {
-		newSortDirection = "desc"
-	} else if vm.SortDirection == "desc" {
-		newSortDirection = "asc"
+func (vm *TableViewModel) UpdateKinds(ctx context.Context) error {
+
+	kinds, err := service.GetAllKinds(ctx, vm.client, vm.Namespace)
+	if err != nil {
+		return err
 	}
+	vm.Kinds = kinds
+	return nil
+}
+
+func (vm *TableViewModel) SelectKind(kind string) error {
+	vm.Selected = kind
+	vm.Filters = nil
+	vm.Ancestor = nil
 	vm.Reset()
-	vm.SortDirection = newSortDirection
+	return nil
 
 }
 
@@ -70,17 +100,33 @@ func (vm *TableViewModel) RowCount() int {
 }
 
 func (vm *TableViewModel) Reset() {
+	vm.Sorts = nil
+	vm.Headers = nil
+	vm.seenHeaders = nil
+	vm.View = nil
+	vm.Refresh()
+}
+
+// Refresh drops the paged in entities so they are fetched again, keeping the sort
+func (vm *TableViewModel) Refresh() {
+	vm.kindHeaders = nil
 	vm.Cursor = ""
-	vm.SortKey = ""
-	vm.SortDirection = ""
 	vm.Entities = nil
 	vm.CurrentPage = 0
 	vm.Pages = 0
+	vm.PageOffset = 0
+	vm.pageCursors = nil
 	vm.HasPrevPage = false
 	vm.HasNextPage = true
 
 }
 
+func (vm *TableViewModel) ClearMessages() {
+	vm.Message = ""
+	vm.Error = ""
+	vm.ColumnsOpen = false
+}
+
 func (vm *TableViewModel) DebugInfo() {
 
 	fmt.Println("Selected", vm.Selected)
@@ -88,23 +134,78 @@ func (vm *TableViewModel) DebugInfo() {
 	fmt.Println("CurrentPage", vm.CurrentPage)
 	fmt.Println("PageSize", vm.PageSize)
 	fmt.Println("Pages", vm.Pages)
-	fmt.Println("SortKey", vm.SortKey)
-	fmt.Println("SortDirection", vm.SortDirection)
+	fmt.Println("Sorts", vm.Sorts)
+
+}
+
+// Layout is the column layout of the selected kind
+func (vm *TableViewModel) Layout() ColumnLayout {
+	return vm.Layouts.Get(vm.Namespace, vm.Selected)
+}
+
+// Columns are the shown headers in layout order, the pinned ones first
+func (vm *TableViewModel) Columns() []service.TableHeader {
+	return vm.Layout().Arrange(vm.Headers, false)
+}
+
+// PinnedColumns is how many of Columns are pinned
+func (vm *TableViewModel) PinnedColumns() int {
+	layout := vm.Layout()
+	pinned := 0
+	for _, h := range vm.Columns() {
+		if layout.IsPinned(h.Name) {
+			pinned++
+		}
+	}
+	return pinned
+}
+
+// UpdateColumns hides or shows, moves or pins column and saves the layout of the kind
+func (vm *TableViewModel) UpdateColumns(action string, column string) error {
+	if vm.Layouts == nil {
+		return fmt.Errorf("column layouts are not saved")
+	}
+	if vm.Selected == "" {
+		return fmt.Errorf("No kind selected")
+	}
+	layout, err := vm.Layout().Update(vm.Headers, action, column)
+	if err != nil {
+		return err
+	}
+	vm.ColumnsOpen = true
+	if err := vm.Layouts.Set(vm.Namespace, vm.Selected, layout); err != nil {
+		return fmt.Errorf("saving column layout: %s", err)
+	}
+	return nil
+}
 
+// query describes the next page of the table
+func (vm *TableViewModel) query() service.EntityQuery {
+	return service.EntityQuery{
+		Namespace: vm.Namespace,
+		Kind:      vm.Selected,
+		Filters:   vm.Filters,
+		Ancestor:  vm.Ancestor,
+		Orders:    vm.Sorts,
+		Limit:     vm.PageSize,
+		Cursor:    vm.Cursor,
+	}
 }
 
 func (vm *TableViewModel) GetNewPage(ctx context.Context) error {
-	fmt.Println("Getting new page")
+	log.Println("Getting new page")
 	if vm.Selected == "" {
 		return fmt.Errorf("No kind selected")
 	}
 
-	entities, nextCursor, err := service.GetAllEntities(ctx, vm.client, vm.Selected, vm.SortKey, vm.SortDirection, vm.PageSize, vm.Cursor)
+	entities, nextCursor, err := service.GetAllEntities(ctx, vm.client, vm.query())
 
 	if err != nil {
 		return err
 	}
 
+	vm.recordQuery(vm.State())
+	vm.pageCursors = append(vm.pageCursors, vm.Cursor)
 	vm.Entities = append(vm.Entities, entities...)
 	vm.Cursor = nextCursor
 
@@ -114,3 +215,74 @@ func (vm *TableViewModel) GetNewPage(ctx context.Context) error {
 	vm.HasNextPage = nextCursor != ""
 	return nil
 }
+
+// schemaSampleSize is how many entities are read to infer the properties of a new entity
+const schemaSampleSize = 100
+
+// NewEntity starts a new entity of the selected kind, pre-populated with the
+// property names and types found in a sample of existing entities
+func (vm *TableViewModel) NewEntity(ctx context.Context) (*EntityViewModel, error) {
+	if vm.Selected == "" {
+		return nil, fmt.Errorf("No kind selected")
+	}
+
+	sample, _, err := service.GetAllEntities(ctx, vm.client, service.EntityQuery{
+		Namespace: vm.Namespace,
+		Kind:      vm.Selected,
+		Limit:     schemaSampleSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	evm := NewEntityViewModel(vm.client)
+	evm.Stats = vm.Stats
+	evm.Namespace = vm.Namespace
+	evm.Kind = vm.Selected
+	evm.KeyMode = KeyModeIncomplete
+	for _, header := range service.GetTableHeaders(sample) {
+		if header.Name == "key" {
+			continue
+		}
+		for _, e := range sample {
+			if prop, ok := e[header.Name]; ok && prop.TypeOf == header.Type {
+				f := fieldFromValue("", header.Name, prop.Value, prop.Indexed)
+				evm.Fields = append(evm.Fields, blankField(f))
+				break
+			}
+		}
+	}
+	renumberFields(evm.Fields, RootPath)
+	return evm, nil
+}
+
+// DeleteSelected deletes the entities with the given encoded keys
+func (vm *TableViewModel) DeleteSelected(ctx context.Context, encodedKeys []string) error {
+	keys := make([]*datastore.Key, len(encodedKeys))
+	for i, encoded := range encodedKeys {
+		key, err := datastore.DecodeKey(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid key %q", encoded)
+		}
+		keys[i] = key
+	}
+
+	deleted, err := service.DeleteEntities(ctx, vm.client, keys)
+	vm.Stats.ForgetKeys(keys)
+	vm.Refresh()
+	vm.Message = fmt.Sprintf("Deleted %d entities", deleted)
+	return err
+}
+
+// DeleteAll deletes every entity of the selected kind
+func (vm *TableViewModel) DeleteAll(ctx context.Context) error {
+	if vm.Selected == "" {
+		return fmt.Errorf("No kind selected")
+	}
+
+	deleted, err := service.DeleteAllEntities(ctx, vm.client, vm.Namespace, vm.Selected)
+	vm.Stats.Forget(vm.Namespace, vm.Selected)
+	vm.Refresh()
+	vm.Message = fmt.Sprintf("Deleted %d entities of kind %s", deleted, vm.Selected)
+	return err
+}